@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/yasaichi-sandbox/monkey/token"
+	"math/big"
 	"strings"
 )
 
 type Node interface {
 	String() string
 	TokenLiteral() string
+	// NOTE: ソースコード上でノードが占める範囲。Endは末尾の文字の直後の位置を指す
+	Pos() token.Position
+	End() token.Position
 }
 
 type Statement interface {
@@ -46,9 +50,45 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+
+	return token.Position{}
+}
+
+// NOTE: 構文エラーで解析できなかった文。エラー回復後も部分的なASTを返せるようにするためのもの
+type BadStatement struct {
+	Token    token.Token // 文の先頭のトークン
+	EndToken token.Token // 読み飛ばした最後のトークン
+}
+
+func (*BadStatement) String() string {
+	return "<bad statement>"
+}
+
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+func (bs *BadStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BadStatement) End() token.Position { return bs.EndToken.End }
+
+func (*BadStatement) statementNode() {}
+
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // '{'トークン
 	Statements []Statement
+	EndToken   token.Token // '}'トークン
 }
 
 func (bs *BlockStatement) String() string {
@@ -65,8 +105,41 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position { return bs.EndToken.End }
+
 func (*BlockStatement) statementNode() {}
 
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (*BreakStatement) String() string { return "break;" }
+
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position { return bs.Token.End }
+
+func (*BreakStatement) statementNode() {}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (*ContinueStatement) String() string { return "continue;" }
+
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position { return cs.Token.End }
+
+func (*ContinueStatement) statementNode() {}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -84,8 +157,48 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+
+	return es.Token.End
+}
+
 func (*ExpressionStatement) statementNode() {}
 
+// NOTE: `for (x in iterable) { ... }`。配列の要素、ハッシュのキー、文字列の文字を順に`Variable`に束縛する
+type ForStatement struct {
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for(")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position { return fs.Body.End() }
+
+func (*ForStatement) statementNode() {}
+
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
@@ -113,6 +226,19 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+// NOTE: `const`も同じノードで表し、トークンの種類で区別する
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+
+	return ls.Name.End()
+}
+
 func (*LetStatement) statementNode() {}
 
 type ReturnStatement struct {
@@ -138,11 +264,48 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+
+	return rs.Token.End
+}
+
 func (*ReturnStatement) statementNode() {}
 
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position { return ws.Body.End() }
+
+func (*WhileStatement) statementNode() {}
+
 type ArrayLiteral struct {
-	Token    token.Token
+	Token    token.Token // '['トークン
 	Elements []Expression
+	EndToken token.Token // ']'トークン
 }
 
 func (al *ArrayLiteral) String() string {
@@ -158,8 +321,59 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
 
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position { return al.EndToken.End }
+
 func (*ArrayLiteral) expressionNode() {}
 
+// NOTE: `x = 1`や`arr[i] += 1`。`Target`は`Identifier`か`IndexExpression`で、式の値は代入した値になる
+type AssignExpression struct {
+	Token    token.Token // 代入演算子のトークン、例えば「+=」
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+func (ae *AssignExpression) Pos() token.Position { return ae.Target.Pos() }
+func (ae *AssignExpression) End() token.Position { return ae.Value.End() }
+
+func (*AssignExpression) expressionNode() {}
+
+// NOTE: 構文エラーで解析できなかった式
+type BadExpression struct {
+	Token    token.Token // 式の先頭のトークン
+	EndToken token.Token // エラーが見つかった時点のトークン
+}
+
+func (*BadExpression) String() string {
+	return "<bad expression>"
+}
+
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+
+func (be *BadExpression) Pos() token.Position { return be.Token.Pos }
+func (be *BadExpression) End() token.Position { return be.EndToken.End }
+
+func (*BadExpression) expressionNode() {}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -173,12 +387,16 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+func (b *Boolean) End() token.Position { return b.Token.End }
+
 func (*Boolean) expressionNode() {}
 
 type CallExpression struct {
-	Token     token.Token
-	Function  Expression // FunctionLiteral or Identifier
+	Token     token.Token // '('トークン
+	Function  Expression  // FunctionLiteral or Identifier
 	Arguments []Expression
+	EndToken  token.Token // ')'トークン
 }
 
 func (ce *CallExpression) String() string {
@@ -200,8 +418,29 @@ func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) End() token.Position { return ce.EndToken.End }
+
 func (*CallExpression) expressionNode() {}
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
+
+func (*FloatLiteral) expressionNode() {}
+
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
@@ -230,17 +469,21 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position { return fl.Body.End() }
+
 func (*FunctionLiteral) expressionNode() {}
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token    token.Token // '{'トークン
+	Pairs    []HashPair  // NOTE: ソースに書かれた順に並ぶ
+	EndToken token.Token // '}'トークン
 }
 
 func (hl *HashLiteral) String() string {
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
@@ -250,8 +493,16 @@ func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
 
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position { return hl.EndToken.End }
+
 func (*HashLiteral) expressionNode() {}
 
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -266,6 +517,9 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
+
 func (*Identifier) expressionNode() {}
 
 type IfExpression struct {
@@ -295,12 +549,23 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+
+	return ie.Consequence.End()
+}
+
 func (*IfExpression) expressionNode() {}
 
 type IndexExpression struct {
-	Token token.Token // '['トークン
-	Left  Expression
-	Index Expression
+	Token    token.Token // '['トークン
+	Left     Expression
+	Index    Expression
+	EndToken token.Token // ']'トークン
 }
 
 func (ie *IndexExpression) String() string {
@@ -311,6 +576,9 @@ func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IndexExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *IndexExpression) End() token.Position { return ie.EndToken.End }
+
 func (*IndexExpression) expressionNode() {}
 
 type InfixExpression struct {
@@ -336,11 +604,15 @@ func (oe *InfixExpression) TokenLiteral() string {
 	return oe.Token.Literal
 }
 
+func (oe *InfixExpression) Pos() token.Position { return oe.Left.Pos() }
+func (oe *InfixExpression) End() token.Position { return oe.Right.End() }
+
 func (*InfixExpression) expressionNode() {}
 
 type IntegerLiteral struct {
 	Token token.Token
-	Value int64 // NOTE: ソースコード中の整数リテラルが表現している実際の値を格納する
+	Value int64    // NOTE: ソースコード中の整数リテラルが表現している実際の値を格納する
+	Big   *big.Int // NOTE: int64に収まらない場合のみ設定される（このときValueは使わない）
 }
 
 func (il *IntegerLiteral) String() string {
@@ -351,8 +623,57 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
 func (*IntegerLiteral) expressionNode() {}
 
+type MatchExpression struct {
+	Token    token.Token // 'match'トークン
+	Subject  Expression
+	Arms     []MatchArm  // NOTE: 上から順に試し、最初に一致した腕を選ぶ
+	EndToken token.Token // '}'トークン
+}
+
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	return fmt.Sprintf("match(%s) {%s}", me.Subject.String(), strings.Join(arms, ", "))
+}
+
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MatchExpression) Pos() token.Position { return me.Token.Pos }
+func (me *MatchExpression) End() token.Position { return me.EndToken.End }
+
+func (*MatchExpression) expressionNode() {}
+
+// NOTE: `Guard`がある場合は、パターンに一致したうえで`Guard`が真になるときだけ腕を選ぶ。
+// `Body`は式か、`{`で始まる場合は`*BlockStatement`（`if`の本体と同じく、最後の式の値が腕の値になる）
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Node
+}
+
+func (ma MatchArm) String() string {
+	body := ma.Body.String()
+	if _, ok := ma.Body.(*BlockStatement); ok {
+		body = "{" + body + "}"
+	}
+
+	if ma.Guard != nil {
+		return ma.Pattern.String() + " if " + ma.Guard.String() + " => " + body
+	}
+
+	return ma.Pattern.String() + " => " + body
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string // "-" or "!"
@@ -374,6 +695,9 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position { return pe.Right.End() }
+
 func (*PrefixExpression) expressionNode() {}
 
 type StringLiteral struct {
@@ -389,4 +713,7 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
 func (*StringLiteral) expressionNode() {}
@@ -0,0 +1,119 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/token"
+	"strings"
+)
+
+// NOTE: `match`の腕に書くパターン。値に一致するかを調べ、一致すれば値の一部を名前に束縛する
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+type ArrayPattern struct {
+	Token    token.Token // '['トークン
+	Elements []Pattern
+	Rest     *Identifier // NOTE: `...rest`がなければnil。ある場合は要素数が`Elements`以上の配列に一致する
+	EndToken token.Token // ']'トークン
+}
+
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) Pos() token.Position { return ap.Token.Pos }
+func (ap *ArrayPattern) End() token.Position { return ap.EndToken.End }
+
+func (*ArrayPattern) patternNode() {}
+
+type HashPattern struct {
+	Token    token.Token // '{'トークン
+	Pairs    []HashPatternPair
+	EndToken token.Token // '}'トークン
+}
+
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+
+func (hp *HashPattern) Pos() token.Position { return hp.Token.Pos }
+func (hp *HashPattern) End() token.Position { return hp.EndToken.End }
+
+func (*HashPattern) patternNode() {}
+
+// NOTE: キーは式として評価する。パターンに書かれていないキーがハッシュにあっても一致する
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+type IdentifierPattern struct {
+	Name *Identifier // NOTE: `_`の場合は何も束縛しない
+	Type *Identifier // NOTE: 型を指定しなければnil
+}
+
+func (ip *IdentifierPattern) String() string {
+	if ip.Type != nil {
+		return ip.Name.String() + ": " + ip.Type.String()
+	}
+
+	return ip.Name.String()
+}
+
+func (ip *IdentifierPattern) TokenLiteral() string {
+	return ip.Name.TokenLiteral()
+}
+
+func (ip *IdentifierPattern) Pos() token.Position { return ip.Name.Pos() }
+
+func (ip *IdentifierPattern) End() token.Position {
+	if ip.Type != nil {
+		return ip.Type.End()
+	}
+
+	return ip.Name.End()
+}
+
+func (*IdentifierPattern) patternNode() {}
+
+// NOTE: 識別子や`[`、`{`以外で始まるパターン。式を評価した値と等しければ一致する。
+// 変数の値と比べたい場合は`(x)`のように括弧で囲む
+type ValuePattern struct {
+	Value Expression
+}
+
+func (vp *ValuePattern) String() string {
+	return vp.Value.String()
+}
+
+func (vp *ValuePattern) TokenLiteral() string {
+	return vp.Value.TokenLiteral()
+}
+
+func (vp *ValuePattern) Pos() token.Position { return vp.Value.Pos() }
+func (vp *ValuePattern) End() token.Position { return vp.Value.End() }
+
+func (*ValuePattern) patternNode() {}
@@ -0,0 +1,303 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf(
+			"ERROR: operand len %d does not match defined %d\n",
+			len(operands),
+			operandCount,
+		)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	// NOTE: スタックの上からオペランドの数だけの値を、同じ順に複製して積む
+	OpDup
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	// NOTE: `a < b`を`b > a`に置き換えると評価順が変わってしまうので、専用の命令を用意する
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+	// NOTE: 定数プールの文字列をメッセージとして、実行時エラーにする
+	OpError
+	// NOTE: ループに入った時点のスタックの高さを覚えておく。`break`と`continue`は式の途中に書かれていることも
+	// あるので、スタックをその高さまで戻してからオペランドの位置に飛ぶ
+	OpEnterLoop
+	OpExitLoop
+	OpBreak
+	OpContinue
+	// NOTE: `for`で繰り返す値を取り出す。`OpIterNext`は取り出し終えていればオペランドの位置に飛ぶ
+	OpIter
+	OpIterNext
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpSetFree
+	// NOTE: `const`で束縛する。定数かどうかは変数ごとに覚えておき、`OpIsConstGlobal`などで調べる
+	OpSetGlobalConst
+	OpSetLocalConst
+	OpIsConstGlobal
+	OpIsConstLocal
+	OpIsConstFree
+	// NOTE: 変数に値が束縛されているかどうかを真偽値として積む。内側のスコープの`let`がまだ実行されて
+	// いなければ外側の同じ名前を参照する、という評価器の名前解決を再現するために使う
+	OpDefinedGlobal
+	OpDefinedLocal
+	OpDefinedFree
+	// NOTE: クロージャに取り込むために、変数の値ではなく変数そのもの（セル）を積む
+	OpCaptureLocal
+	OpCaptureFree
+	// NOTE: ループの本体の変数を繰り返しごとに未定義に戻す。取り込まれたセルも切り離すので、
+	// 本体で作ったクロージャはその回の変数を捕まえる
+	OpClearLocal
+
+	OpArray
+	OpHash
+	OpIndex
+	// NOTE: 配列やハッシュ、添字、値を取り除き、代入した値を積む
+	OpSetIndex
+	// NOTE: `match`のパターンを調べる。`OpMatchValue`は2つの値が等しいかどうかを真偽値として積み、
+	// `OpNoMatch`はどの腕にも一致しなかった値を実行時エラーにする
+	OpMatchValue
+	OpNoMatch
+	// NOTE: `OpMatchType`はオペランドの定数の名前の型かどうか、`OpMatchArray`は1つ目のオペランドの数の要素を
+	// 持つ配列かどうか（2つ目のオペランドが1なら、それより多くてもよい）、`OpMatchKey`はハッシュにキーがあるかどうかを積む。
+	// `OpRest`は配列のオペランドの位置以降の要素を、新しい配列として積む
+	OpMatchType
+	OpMatchArray
+	OpMatchKey
+	OpRest
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // 各オペランドが何バイトを占めるか
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{1}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpError:         {"OpError", []int{2}},
+	OpEnterLoop:     {"OpEnterLoop", []int{}},
+	OpExitLoop:      {"OpExitLoop", []int{}},
+	OpBreak:         {"OpBreak", []int{2}},
+	OpContinue:      {"OpContinue", []int{2}},
+	OpIter:          {"OpIter", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpSetGlobalConst: {"OpSetGlobalConst", []int{2}},
+	OpSetLocalConst:  {"OpSetLocalConst", []int{1}},
+	OpIsConstGlobal:  {"OpIsConstGlobal", []int{2}},
+	OpIsConstLocal:   {"OpIsConstLocal", []int{1}},
+	OpIsConstFree:    {"OpIsConstFree", []int{1}},
+	OpDefinedGlobal:  {"OpDefinedGlobal", []int{2}},
+	OpDefinedLocal:   {"OpDefinedLocal", []int{1}},
+	OpDefinedFree:    {"OpDefinedFree", []int{1}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:    {"OpCaptureFree", []int{1}},
+	OpClearLocal:     {"OpClearLocal", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpMatchValue: {"OpMatchValue", []int{}},
+	OpNoMatch:    {"OpNoMatch", []int{}},
+	OpMatchType:  {"OpMatchType", []int{2}},
+	OpMatchArray: {"OpMatchArray", []int{2, 1}},
+	OpMatchKey:   {"OpMatchKey", []int{}},
+	OpRest:       {"OpRest", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	// NOTE: 1つ目のオペランドは定数プール内の関数のインデックス、2つ目は自由変数の数
+	OpClosure: {"OpClosure", []int{2, 1}},
+}
+
+// NOTE: `Make`はオペランドを幅に合わせて切り詰めるので、収まらない値は先にここで調べる
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+
+	for i, o := range operands {
+		max := 1<<(8*def.OperandWidths[i]) - 1
+		if o < 0 || o > max {
+			return fmt.Errorf("operand of %s out of range: %d (max %d)", def.Name, o, max)
+		}
+	}
+
+	return nil
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+
+		// NOTE: オペランドはビッグエンディアンでエンコードする
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
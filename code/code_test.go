@@ -0,0 +1,127 @@
+package code_test
+
+import (
+	"github.com/yasaichi-sandbox/monkey/code"
+	"testing"
+)
+
+func TestCheckOperands(t *testing.T) {
+	tests := []struct {
+		op       code.Opcode
+		operands []int
+		expected string
+	}{
+		{code.OpConstant, []int{65535}, ""},
+		{code.OpConstant, []int{65536}, "operand of OpConstant out of range: 65536 (max 65535)"},
+		{code.OpGetLocal, []int{255}, ""},
+		{code.OpGetLocal, []int{256}, "operand of OpGetLocal out of range: 256 (max 255)"},
+		{code.OpClosure, []int{0, 256}, "operand of OpClosure out of range: 256 (max 255)"},
+	}
+
+	for _, tt := range tests {
+		err := code.CheckOperands(tt.op, tt.operands...)
+
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+
+		if actual != tt.expected {
+			t.Errorf("wrong error for %v. want=%q, got=%q", tt.operands, tt.expected, actual)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []code.Instructions{
+		code.Make(code.OpAdd),
+		code.Make(code.OpGetLocal, 1),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpConstant, 65535),
+		code.Make(code.OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := code.Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf(
+			"instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected,
+			concatted.String(),
+		)
+	}
+}
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       code.Opcode
+		operands []int
+		expected []byte
+	}{
+		{code.OpConstant, []int{65534}, []byte{byte(code.OpConstant), 255, 254}},
+		{code.OpAdd, []int{}, []byte{byte(code.OpAdd)}},
+		{code.OpGetLocal, []int{255}, []byte{byte(code.OpGetLocal), 255}},
+		{code.OpClosure, []int{65534, 255}, []byte{byte(code.OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := code.Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf(
+				"instruction has wrong length. want=%d, got=%d",
+				len(tt.expected),
+				len(instruction),
+			)
+			continue
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        code.Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{code.OpConstant, []int{65535}, 2},
+		{code.OpGetLocal, []int{255}, 1},
+		{code.OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := code.Make(tt.op, tt.operands...)
+
+		def, err := code.Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := code.ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
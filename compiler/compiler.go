@@ -0,0 +1,929 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/code"
+	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/token"
+	"math"
+	"os"
+	"strconv"
+)
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	Positions    map[int]token.Position // 命令のオフセットから、その命令を生成したノードの位置を引く
+	GlobalNames  []string               // グローバル変数の名前。実行時のエラーメッセージに使う
+	LocalNames   []string               // トップレベルのループの本体などで定義した、メインのフレームのローカル変数の名前
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	positions           map[int]token.Position
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loop // コンパイル中のループ（内側のものほど後ろ）。関数をまたいで`break`することはない
+}
+
+// NOTE: 同じ値の定数は定数プールで共有する。整数の1と浮動小数点数の1.0は区別する
+type constantKey struct {
+	objectType object.ObjectType
+	value      string
+}
+
+// NOTE: `break`の飛び先はループを閉じるまで分からないので、後で書き換える位置を覚えておく
+type loop struct {
+	breakPositions   []int
+	continuePosition int // `continue`の飛び先（`while`は条件、`for`は次の値を取り出す命令）
+}
+
+type Compiler struct {
+	constants       []object.Object
+	constantIndexes map[constantKey]int // 関数以外の定数から、定数プール内のインデックスを引く
+	symbolTable     *SymbolTable
+	constNames      map[string]bool // `const`で束縛される名前。これらの名前の束縛と代入でだけ、定数かどうかを調べる
+	operandErr      error           // オペランドの幅に収まらなかった最初の値のエラー
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+var compoundAssignOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+}
+
+// NOTE: 変数が`const`で束縛されているかどうかを調べる命令
+var isConstOperators = map[SymbolScope]code.Opcode{
+	GlobalScope: code.OpIsConstGlobal,
+	LocalScope:  code.OpIsConstLocal,
+	FreeScope:   code.OpIsConstFree,
+}
+
+// NOTE: 変数に値が入っているかどうかを調べる命令。組み込み関数は常に値があるので調べない
+var definedOperators = map[SymbolScope]code.Opcode{
+	GlobalScope: code.OpDefinedGlobal,
+	LocalScope:  code.OpDefinedLocal,
+	FreeScope:   code.OpDefinedFree,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+}
+
+func New() *Compiler {
+	return NewWithBuiltins(object.NewBuiltins(os.Stdout))
+}
+
+// NOTE: VMには同じ組み込み関数の一覧を渡すこと。コンパイラは名前と順番しか使わない
+func NewWithBuiltins(builtins []object.BuiltinDefinition) *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, b := range builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+		positions:    map[int]token.Position{},
+	}
+
+	return &Compiler{
+		constants:       []object.Object{},
+		constantIndexes: map[constantKey]int{},
+		symbolTable:     symbolTable,
+		constNames:      map[string]bool{},
+		scopes:          []CompilationScope{mainScope},
+		scopeIndex:      0,
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Positions:    c.scopes[c.scopeIndex].positions,
+		GlobalNames:  c.symbolTable.names(),
+		LocalNames:   c.symbolTable.localNames,
+	}
+}
+
+// NOTE: 評価器と同じエラーを返せるように、コンパイル時に見つかったエラーも`object.Error`で表す。
+// オペランドの幅に収まらない値は命令を作る時点で覚えておき、ここで返す
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compileNode(node); err != nil {
+		return err
+	}
+
+	return c.operandErr
+}
+
+func (c *Compiler) compileNode(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.hoist(node)
+
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+
+		c.emit(node, code.OpPop)
+	case *ast.LetStatement:
+		// NOTE: 変数はスコープに入った時点で確保してあるので、ここでは値を入れるだけ
+		symbol := c.symbolTable.Define(node.Name.Value)
+
+		// NOTE: 評価器と同じく、定数の再宣言は値を評価する前にエラーにする
+		if c.constNames[node.Name.Value] {
+			c.checkNotConst(node, symbol, fmt.Sprintf("cannot redeclare constant %s", node.Name.Value))
+		}
+
+		// NOTE: スタックトレースに表示するため、関数リテラルを束縛した名前を覚えておく
+		if fl, ok := node.Value.(*ast.FunctionLiteral); ok {
+			if err := c.compileFunctionLiteral(fl, node.Name.Value); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if node.IsConst() {
+			c.storeConstSymbol(node, symbol)
+		} else {
+			c.storeSymbol(node, symbol)
+		}
+		c.symbolTable.markDefined(node.Name.Value)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+
+		c.emit(node, code.OpReturnValue)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return newError(node, "break outside loop")
+		}
+
+		loop.breakPositions = append(loop.breakPositions, c.emit(node, code.OpBreak, 9999))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return newError(node, "continue outside loop")
+		}
+
+		c.emit(node, code.OpContinue, loop.continuePosition)
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(node, code.OpCall, len(node.Arguments))
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.InfixExpression:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return newError(node, "unknown operator: %s", node.Operator)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		c.emit(node, op)
+	case *ast.PrefixExpression:
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return newError(node, "unknown operator: %s", node.Operator)
+		}
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		c.emit(node, op)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+
+		c.emit(node, code.OpArray, len(node.Elements))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(node, code.OpTrue)
+		} else {
+			c.emit(node, code.OpFalse)
+		}
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+	case *ast.HashLiteral:
+		return c.compileHashLiteral(node)
+	case *ast.Identifier:
+		c.loadName(node)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+
+		c.emit(node, code.OpIndex)
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
+
+		c.emit(node, code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		c.emit(node, code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(node, code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.BadStatement, *ast.BadExpression:
+		return newError(node, "invalid syntax at %s", node.Pos())
+	default:
+		return newError(node, "unsupported node: %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	var key constantKey
+	switch obj := obj.(type) {
+	case *object.Integer:
+		key = constantKey{obj.Type(), strconv.FormatInt(obj.Value, 10)}
+	case *object.BigInt:
+		key = constantKey{obj.Type(), obj.Value.String()}
+	case *object.Float:
+		key = constantKey{obj.Type(), strconv.FormatUint(math.Float64bits(obj.Value), 16)}
+	case *object.String:
+		key = constantKey{obj.Type(), obj.Value}
+	default:
+		c.constants = append(c.constants, obj)
+		return len(c.constants) - 1
+	}
+
+	if i, ok := c.constantIndexes[key]; ok {
+		return i
+	}
+
+	c.constants = append(c.constants, obj)
+	c.constantIndexes[key] = len(c.constants) - 1
+
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	return posNewInstruction
+}
+
+// NOTE: 代入は既にある束縛を書き換えるだけなので、組み込み関数は代入先にならない
+func (c *Compiler) assignableSymbols(name string) []Symbol {
+	symbols := []Symbol{}
+	for _, s := range c.symbolTable.ResolveAll(name) {
+		if s.Scope != BuiltinScope {
+			symbols = append(symbols, s)
+		}
+	}
+
+	if len(symbols) == 0 {
+		symbols = append(symbols, c.globalSymbolTable().Define(name))
+	}
+
+	return symbols
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(c.scopes[c.scopeIndex].positions[opPos], op, operand)
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// NOTE: 評価器と同じく、代入先があるかどうかは右辺を評価する前に確かめる
+// NOTE: 値が入っている最も内側の変数が`const`で束縛されていればエラーにする
+func (c *Compiler) checkAssignable(node ast.Node, symbols []Symbol, message string) {
+	jumpPositions := []int{}
+	for _, s := range symbols {
+		c.emit(node, definedOperators[s.Scope], s.Index)
+		jumpNotTruthyPos := c.emit(node, code.OpJumpNotTruthy, 9999)
+
+		c.checkNotConst(node, s, message)
+		jumpPositions = append(jumpPositions, c.emit(node, code.OpJump, 9999))
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	}
+
+	for _, pos := range jumpPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) checkOperands(pos token.Position, op code.Opcode, operands ...int) {
+	if c.operandErr != nil {
+		return
+	}
+
+	if err := code.CheckOperands(op, operands...); err != nil {
+		c.operandErr = &object.Error{Message: err.Error(), Pos: pos}
+	}
+}
+
+func (c *Compiler) checkNotConst(node ast.Node, s Symbol, message string) {
+	c.emit(node, isConstOperators[s.Scope], s.Index)
+	jumpNotTruthyPos := c.emit(node, code.OpJumpNotTruthy, 9999)
+
+	c.emit(node, code.OpError, c.addConstant(&object.String{Value: message}))
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbols := c.assignableSymbols(target.Value)
+
+		// NOTE: 複合代入では読んだ値を演算に使い、そうでなければ捨てる
+		c.loadSymbols(node, symbols)
+		if node.Operator == "=" {
+			c.emit(node, code.OpPop)
+		}
+
+		if c.constNames[target.Value] {
+			c.checkAssignable(node, symbols, fmt.Sprintf("cannot assign to constant %s", target.Value))
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if node.Operator != "=" {
+			c.emit(node, compoundAssignOperators[node.Operator])
+		}
+
+		// NOTE: 代入した値を式の値として残す
+		c.emit(node, code.OpDup, 1)
+		c.storeSymbols(node, symbols)
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+
+		if node.Operator != "=" {
+			c.emit(node, code.OpDup, 2)
+			c.emit(node, code.OpIndex)
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if node.Operator != "=" {
+			c.emit(node, compoundAssignOperators[node.Operator])
+		}
+
+		c.emit(node, code.OpSetIndex)
+	default:
+		return newError(node, "cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+// NOTE: 評価器と同じく、本体は繰り返しごとに新しいスコープで実行する
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+
+	// NOTE: 繰り返せない値のエラーは、評価器と同じく繰り返す式の位置で報告する
+	c.emit(node.Iterable, code.OpIter)
+	c.emit(node, code.OpEnterLoop)
+	nextPos := c.emit(node, code.OpIterNext, 9999)
+
+	c.enterBlockScope()
+
+	variable := c.symbolTable.Define(node.Variable.Value)
+	c.hoist(node.Body)
+
+	for _, s := range c.symbolTable.blockSymbols() {
+		c.emit(node, code.OpClearLocal, s.Index)
+	}
+	c.emit(node, code.OpSetLocal, variable.Index)
+	c.symbolTable.markDefined(node.Variable.Value)
+
+	loop := c.enterLoop(nextPos)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(node, code.OpJump, nextPos)
+
+	c.leaveLoop()
+	c.leaveBlockScope()
+
+	c.changeOperand(nextPos, len(c.currentInstructions()))
+	c.patchBreaks(loop)
+
+	c.emit(node, code.OpExitLoop)
+	c.emit(node, code.OpPop) // NOTE: 取り出し終えた値の列を捨てる
+	c.emitNullStatement(node)
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+		c.symbolTable.markDefined(p.Value)
+	}
+	c.hoist(node.Body)
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// NOTE: 最後の式の値を暗黙的に返す
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(node, code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := len(c.symbolTable.localNames)
+	localNames := c.symbolTable.localNames
+	freeNames := c.symbolTable.freeNames()
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	// NOTE: 外側の関数と変数を共有するため、値ではなく変数そのものを取り込む
+	for _, s := range freeSymbols {
+		if s.Scope == LocalScope {
+			c.emit(node, code.OpCaptureLocal, s.Index)
+		} else {
+			c.emit(node, code.OpCaptureFree, s.Index)
+		}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Positions:     positions,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	}
+	c.emit(node, code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) compileHashLiteral(node *ast.HashLiteral) error {
+	for _, pair := range node.Pairs {
+		if err := c.Compile(pair.Key); err != nil {
+			return err
+		}
+
+		if err := c.Compile(pair.Value); err != nil {
+			return err
+		}
+	}
+
+	c.emit(node, code.OpHash, len(node.Pairs)*2)
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// NOTE: ジャンプ先はまだ分からないので、仮のオフセットを入れておいて後で書き換える
+	jumpNotTruthyPos := c.emit(node, code.OpJumpNotTruthy, 9999)
+
+	// NOTE: 本体の`let`は実行されるとは限らないので、その名前は必ず値が入っているとはみなさない
+	c.symbolTable.conditional++
+	defer func() { c.symbolTable.conditional-- }()
+
+	if err := c.Compile(node.Consequence); err != nil {
+		return err
+	}
+
+	// NOTE: ブロックの最後の式の値をif式の値として残す
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(node, code.OpNull)
+	}
+
+	jumpPos := c.emit(node, code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(node, code.OpNull)
+	} else {
+		if err := c.Compile(node.Alternative); err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+		} else if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(node, code.OpNull)
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// NOTE: `for`と同じく、本体は繰り返しごとに新しいスコープで実行する
+// NOTE: 評価器と同じく腕を上から順に試し、腕ごとに新しいスコープでパターンが束縛する名前を登録する。
+// 照らし合わせる値は名前のないローカル変数に入れておき、どの腕にも一致しなければ実行時エラーにする
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+
+	subject := c.symbolTable.defineTemporary()
+	c.emit(node, code.OpSetLocal, subject.Index)
+
+	endPositions := []int{}
+	for _, arm := range node.Arms {
+		c.enterBlockScope()
+
+		c.hoistPattern(arm.Pattern)
+		if arm.Guard != nil {
+			c.hoist(arm.Guard)
+		}
+		c.hoist(arm.Body)
+		for _, s := range c.symbolTable.blockSymbols() {
+			c.emit(node, code.OpClearLocal, s.Index)
+		}
+
+		failPositions, err := c.compilePattern(arm.Pattern, subject)
+		if err != nil {
+			return err
+		}
+
+		if arm.Guard != nil {
+			if err := c.Compile(arm.Guard); err != nil {
+				return err
+			}
+
+			failPositions = append(failPositions, c.emit(arm.Guard, code.OpJumpNotTruthy, 9999))
+		}
+
+		if err := c.Compile(arm.Body); err != nil {
+			return err
+		}
+
+		// NOTE: ブロックの腕は`if`の本体と同じく、最後の式の値を腕の値として残す
+		if _, ok := arm.Body.(*ast.BlockStatement); ok {
+			if c.lastInstructionIs(code.OpPop) {
+				c.removeLastPop()
+			} else if !c.lastInstructionIs(code.OpReturnValue) {
+				c.emit(node, code.OpNull)
+			}
+		}
+		endPositions = append(endPositions, c.emit(node, code.OpJump, 9999))
+
+		c.leaveBlockScope()
+
+		for _, pos := range failPositions {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+
+	c.emit(node, code.OpGetLocal, subject.Index)
+	c.emit(node, code.OpNoMatch)
+	c.symbolTable.releaseTemporary(subject)
+
+	for _, pos := range endPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	c.emit(node, code.OpEnterLoop)
+
+	conditionPos := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(node, code.OpJumpNotTruthy, 9999)
+
+	c.enterBlockScope()
+
+	c.hoist(node.Body)
+	for _, s := range c.symbolTable.blockSymbols() {
+		c.emit(node, code.OpClearLocal, s.Index)
+	}
+
+	loop := c.enterLoop(conditionPos)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(node, code.OpJump, conditionPos)
+
+	c.leaveLoop()
+	c.leaveBlockScope()
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	c.patchBreaks(loop)
+
+	c.emit(node, code.OpExitLoop)
+	c.emitNullStatement(node)
+
+	return nil
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+
+	return loops[len(loops)-1]
+}
+
+func (c *Compiler) emit(node ast.Node, op code.Opcode, operands ...int) int {
+	c.checkOperands(node.Pos(), op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.scopes[c.scopeIndex].positions[pos] = node.Pos()
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// NOTE: 評価器でループの本体が文としてnullになるのに合わせ、nullを積んで捨てる。
+// 関数やif式の最後に置かれた場合は、最後の`OpPop`が書き換えられてこのnullが値になる
+func (c *Compiler) emitNullStatement(node ast.Node) {
+	c.emit(node, code.OpNull)
+	c.emit(node, code.OpPop)
+}
+
+func (c *Compiler) enterBlockScope() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) enterLoop(continuePosition int) *loop {
+	loop := &loop{continuePosition: continuePosition}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+
+	return loop
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: code.Instructions{},
+		positions:    map[int]token.Position{},
+	}
+
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) globalSymbolTable() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) leaveBlockScope() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func (c *Compiler) leaveLoop() {
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// NOTE: 名前を束縛しうる変数を内側から順に調べ、最初に値が入っているものを読む。
+// どれにも値がなければ、最後の変数を読んだ時点で`identifier not found`になる
+func (c *Compiler) loadName(node *ast.Identifier) {
+	symbols := c.symbolTable.ResolveAll(node.Value)
+	if len(symbols) == 0 {
+		// NOTE: どこでも束縛されない名前は、値が入ることのないグローバル変数として扱う
+		symbols = append(symbols, c.globalSymbolTable().Define(node.Value))
+	}
+
+	c.loadSymbols(node, symbols)
+}
+
+func (c *Compiler) loadSymbol(node ast.Node, s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(node, code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(node, code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(node, code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(node, code.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) loadSymbols(node ast.Node, symbols []Symbol) {
+	jumpPositions := []int{}
+	for _, s := range symbols[:len(symbols)-1] {
+		c.emit(node, definedOperators[s.Scope], s.Index)
+		jumpNotTruthyPos := c.emit(node, code.OpJumpNotTruthy, 9999)
+
+		c.loadSymbol(node, s)
+		jumpPositions = append(jumpPositions, c.emit(node, code.OpJump, 9999))
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	}
+
+	c.loadSymbol(node, symbols[len(symbols)-1])
+
+	for _, pos := range jumpPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+// NOTE: `break`はループを抜ける命令（`OpExitLoop`）に飛ぶので、それを出力する直前に呼ぶ
+func (c *Compiler) patchBreaks(loop *loop) {
+	for _, pos := range loop.breakPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	delete(c.scopes[c.scopeIndex].positions, last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) storeConstSymbol(node ast.Node, s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(node, code.OpSetGlobalConst, s.Index)
+	} else {
+		c.emit(node, code.OpSetLocalConst, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(node ast.Node, s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(node, code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(node, code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(node, code.OpSetFree, s.Index)
+	}
+}
+
+// NOTE: 評価器の代入と同じく、値が入っている最も内側の変数に書き込む
+func (c *Compiler) storeSymbols(node ast.Node, symbols []Symbol) {
+	jumpPositions := []int{}
+	for _, s := range symbols[:len(symbols)-1] {
+		c.emit(node, definedOperators[s.Scope], s.Index)
+		jumpNotTruthyPos := c.emit(node, code.OpJumpNotTruthy, 9999)
+
+		c.storeSymbol(node, s)
+		jumpPositions = append(jumpPositions, c.emit(node, code.OpJump, 9999))
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	}
+
+	c.storeSymbol(node, symbols[len(symbols)-1])
+
+	for _, pos := range jumpPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func newError(node ast.Node, format string, a ...interface{}) error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Pos: node.Pos()}
+}
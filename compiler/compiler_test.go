@@ -0,0 +1,831 @@
+package compiler_test
+
+import (
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/code"
+	"github.com/yasaichi-sandbox/monkey/compiler"
+	"github.com/yasaichi-sandbox/monkey/lexer"
+	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/parser"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = 1; x += 2;`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpDup, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = [1]; a[0] = 2;`,
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let n = 0; fn() { n = 1 }`,
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `len([]); push([], 1);`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 6),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 7),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a) { fn(b) { a + b } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `if (true) { 10 }; 3333;`,
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if (true) { 10 } else { 20 }; 3333;`,
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `const a = 1; a = 2;`,
+			expectedConstants: []interface{}{"cannot redeclare constant a", 1, "cannot assign to constant a", 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpIsConstGlobal, 0),
+				// 0003
+				code.Make(code.OpJumpNotTruthy, 9),
+				// 0006
+				code.Make(code.OpError, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpSetGlobalConst, 0),
+				// 0015
+				code.Make(code.OpGetGlobal, 0),
+				// 0018
+				code.Make(code.OpPop),
+				// 0019
+				code.Make(code.OpDefinedGlobal, 0),
+				// 0022
+				code.Make(code.OpJumpNotTruthy, 37),
+				// 0025
+				code.Make(code.OpIsConstGlobal, 0),
+				// 0028
+				code.Make(code.OpJumpNotTruthy, 34),
+				// 0031
+				code.Make(code.OpError, 2),
+				// 0034
+				code.Make(code.OpJump, 37),
+				// 0037
+				code.Make(code.OpConstant, 3),
+				// 0040
+				code.Make(code.OpDup, 1),
+				// 0042
+				code.Make(code.OpSetGlobal, 0),
+				// 0045
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// NOTE: `const`で束縛されない名前は調べない
+			input:             `let a = 1; a = 2;`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 5 + 10 }`,
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let f = fn(a, b) { let c = a; c + b }; f(1, 2);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// NOTE: 同じ値の定数は共有する
+			input:             `{2: 3 * 4, 1: 2}`,
+			expectedConstants: []interface{}{2, 3, 4, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// NOTE: 整数と浮動小数点数は等しくても別の定数にする
+			input:             `{1: "a", 1.0: "a"}`,
+			expectedConstants: []interface{}{1, "a", 1.0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestInfixExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2 % 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMod),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2.5",
+			expectedConstants: []interface{}{1, 2.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `!("a" != "b")`,
+			expectedConstants: []interface{}{"a", "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNotEqual),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// NOTE: 内側のスコープで後から束縛される名前は、値が入るまで外側の同じ名前を参照する
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `while (true) { break; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpEnterLoop),
+				// 0001
+				code.Make(code.OpTrue),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0005
+				code.Make(code.OpBreak, 11),
+				// 0008
+				code.Make(code.OpJump, 1),
+				// 0011
+				code.Make(code.OpExitLoop),
+				// 0012
+				code.Make(code.OpNull),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `for (x in [1]) { continue; }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpEnterLoop),
+				// 0008
+				code.Make(code.OpIterNext, 21),
+				// 0011
+				code.Make(code.OpClearLocal, 0),
+				// 0013
+				code.Make(code.OpSetLocal, 0),
+				// 0015
+				code.Make(code.OpContinue, 8),
+				// 0018
+				code.Make(code.OpJump, 8),
+				// 0021
+				code.Make(code.OpExitLoop),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpNull),
+				// 0024
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `match (1) { 2 => 3, n => n }`,
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetLocal, 0),
+				// 0005
+				code.Make(code.OpGetLocal, 0),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpMatchValue),
+				// 0011
+				code.Make(code.OpJumpNotTruthy, 20),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpJump, 34),
+				// 0020
+				code.Make(code.OpClearLocal, 1),
+				// 0022
+				code.Make(code.OpGetLocal, 0),
+				// 0024
+				code.Make(code.OpSetLocal, 1),
+				// 0026
+				code.Make(code.OpGetLocal, 1),
+				// 0028
+				code.Make(code.OpJump, 34),
+				// 0031
+				code.Make(code.OpGetLocal, 0),
+				// 0033
+				code.Make(code.OpNoMatch),
+				// 0034
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `match (1) { x: INTEGER => x }`,
+			expectedConstants: []interface{}{1, "INTEGER"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetLocal, 0),
+				// 0005
+				code.Make(code.OpClearLocal, 1),
+				// 0007
+				code.Make(code.OpGetLocal, 0),
+				// 0009
+				code.Make(code.OpMatchType, 1),
+				// 0012
+				code.Make(code.OpJumpNotTruthy, 24),
+				// 0015
+				code.Make(code.OpGetLocal, 0),
+				// 0017
+				code.Make(code.OpSetLocal, 1),
+				// 0019
+				code.Make(code.OpGetLocal, 1),
+				// 0021
+				code.Make(code.OpJump, 27),
+				// 0024
+				code.Make(code.OpGetLocal, 0),
+				// 0026
+				code.Make(code.OpNoMatch),
+				// 0027
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestNameResolution(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let x = 1; fn() { x; let x = 2; }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpDefinedLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 10),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpJump, 13),
+					// 0010
+					code.Make(code.OpGetGlobal, 0),
+					// 0013
+					code.Make(code.OpPop),
+					// 0014
+					code.Make(code.OpConstant, 1),
+					// 0017
+					code.Make(code.OpSetLocal, 0),
+					// 0019
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// NOTE: 必ず値が入っている変数は、外側の同じ名前を調べずに参照する
+			input: `let x = 1; fn(x) { x }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let x = 1; fn() { let x = 2; x }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let len = 1; len`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// NOTE: `if`の本体の`let`は実行されるとは限らないので、外側の同じ名前も調べる
+			input:             `if (true) { let len = 1; } len`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpDefinedGlobal, 0),
+				// 0019
+				code.Make(code.OpJumpNotTruthy, 28),
+				// 0022
+				code.Make(code.OpGetGlobal, 0),
+				// 0025
+				code.Make(code.OpJump, 30),
+				// 0028
+				code.Make(code.OpGetBuiltin, 6),
+				// 0030
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `foobar; let a = 1;`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+// NOTE: オペランドの幅に収まらない値は、切り詰めずにコンパイルエラーにする
+func TestOperandLimits(t *testing.T) {
+	lets := func(n int) string {
+		var out strings.Builder
+		out.WriteString("fn() { ")
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&out, "let x%d = %d; ", i, i)
+		}
+		out.WriteString("}")
+
+		return out.String()
+	}
+
+	list := func(n int, element func(i int) string) string {
+		elements := make([]string, n)
+		for i := range elements {
+			elements[i] = element(i)
+		}
+
+		return strings.Join(elements, ", ")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{lets(256), ""},
+		{lets(257), "operand of OpSetLocal out of range: 256 (max 255)"},
+		{"[" + list(65535, func(int) string { return "1" }) + "]", ""},
+		{"[" + list(65536, func(int) string { return "1" }) + "]", "operand of OpArray out of range: 65536 (max 65535)"},
+		{strings.ReplaceAll(list(65537, strconv.Itoa), ",", ";"), "operand of OpConstant out of range: 65536 (max 65535)"},
+		// NOTE: `match`の名前のないローカル変数は使い回すので、腕がいくつあっても増えない
+		{"fn() { match ([[1]]) { " + list(300, func(int) string { return "[[_]] => 1" }) + " } }", ""},
+	}
+
+	for _, tt := range tests {
+		err := compiler.New().Compile(parse(tt.input))
+
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+
+		if actual != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let countDown = fn(x) { countDown(x - 1); }; countDown(1);`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestResolveFree(t *testing.T) {
+	global := compiler.NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := compiler.NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := compiler.NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	expected := []compiler.Symbol{
+		{Name: "a", Scope: compiler.GlobalScope, Index: 0},
+		{Name: "b", Scope: compiler.FreeScope, Index: 0},
+		{Name: "c", Scope: compiler.LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	expectedFree := compiler.Symbol{Name: "b", Scope: compiler.LocalScope, Index: 0}
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0] != expectedFree {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		c := compiler.New()
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := c.Bytecode()
+		testInstructions(t, tt.expectedInstructions, bytecode.Instructions)
+		testConstants(t, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testConstants(t *testing.T, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(expected), len(actual))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("constant %d is not Integer %d. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case float64:
+			float, ok := actual[i].(*object.Float)
+			if !ok || float.Value != constant {
+				t.Errorf("constant %d is not Float %g. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				t.Errorf("constant %d is not String %q. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d is not CompiledFunction. got=%T (%+v)", i, actual[i], actual[i])
+				continue
+			}
+
+			testInstructions(t, constant, fn.Instructions)
+		}
+	}
+}
+
+func testInstructions(t *testing.T, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+
+	concatted := concatInstructions(expected)
+	if concatted.String() != actual.String() {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q", concatted, actual)
+	}
+}
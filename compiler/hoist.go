@@ -0,0 +1,93 @@
+package compiler
+
+import "github.com/yasaichi-sandbox/monkey/ast"
+
+// NOTE: 評価器の`let`は実行した時点で環境に名前を登録するので、後から束縛される名前でも、
+// 実行時には参照できることがある（先に定義した関数から、後で定義する関数を呼ぶなど）。
+// そのため、スコープに入る時点でそこで束縛されうる名前をすべて変数として確保し、値が入るまでは未定義として扱う。
+// 関数リテラル、ループの本体、`match`の腕は別のスコープなので見ない。
+// `const`で束縛される名前もここで覚えるので、そのスコープの中の束縛や代入をコンパイルする時点では分かっている
+func (c *Compiler) hoist(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			c.hoist(s)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			c.hoist(s)
+		}
+	case *ast.ExpressionStatement:
+		c.hoist(node.Expression)
+	case *ast.LetStatement:
+		c.symbolTable.Define(node.Name.Value)
+		if node.IsConst() {
+			c.constNames[node.Name.Value] = true
+		}
+		c.hoist(node.Value)
+	case *ast.ReturnStatement:
+		c.hoist(node.ReturnValue)
+	case *ast.WhileStatement:
+		c.hoist(node.Condition)
+	case *ast.ForStatement:
+		c.hoist(node.Iterable)
+	case *ast.AssignExpression:
+		c.hoist(node.Target)
+		c.hoist(node.Value)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.hoist(el)
+		}
+	case *ast.CallExpression:
+		c.hoist(node.Function)
+		for _, a := range node.Arguments {
+			c.hoist(a)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			c.hoist(pair.Key)
+			c.hoist(pair.Value)
+		}
+	case *ast.IfExpression:
+		c.hoist(node.Condition)
+		c.hoist(node.Consequence)
+		if node.Alternative != nil {
+			c.hoist(node.Alternative)
+		}
+	case *ast.IndexExpression:
+		c.hoist(node.Left)
+		c.hoist(node.Index)
+	case *ast.InfixExpression:
+		c.hoist(node.Left)
+		c.hoist(node.Right)
+	case *ast.MatchExpression:
+		c.hoist(node.Subject)
+	case *ast.PrefixExpression:
+		c.hoist(node.Right)
+	}
+}
+
+// NOTE: `match`の腕のスコープで束縛されうる名前を登録する。`_`は何も束縛しない
+func (c *Compiler) hoistPattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			c.hoistPattern(el)
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			c.symbolTable.Define(pattern.Rest.Value)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			c.hoist(pair.Key)
+			c.hoistPattern(pair.Value)
+		}
+	case *ast.IdentifierPattern:
+		if pattern.Name.Value != "_" {
+			c.symbolTable.Define(pattern.Name.Value)
+		}
+	case *ast.ValuePattern:
+		c.hoist(pattern.Value)
+	}
+}
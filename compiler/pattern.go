@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/code"
+	"github.com/yasaichi-sandbox/monkey/object"
+)
+
+// NOTE: ローカル変数`value`の値がパターンに一致するかを調べ、一致すればパターンが束縛する名前に値を入れる。
+// 一致しなかった場合に飛ぶ`OpJumpNotTruthy`の位置を返すので、呼び出し側で次の腕の位置に書き換える。
+// 配列の要素やハッシュの値は、名前のないローカル変数に入れてから内側のパターンと照らし合わせ、終わったら返す
+func (c *Compiler) compilePattern(pattern ast.Pattern, value Symbol) ([]int, error) {
+	switch pattern := pattern.(type) {
+	case *ast.IdentifierPattern:
+		failPositions := []int{}
+		if pattern.Type != nil {
+			c.emit(pattern.Type, code.OpGetLocal, value.Index)
+			c.emit(pattern.Type, code.OpMatchType, c.addConstant(&object.String{Value: pattern.Type.Value}))
+			failPositions = append(failPositions, c.emit(pattern, code.OpJumpNotTruthy, 9999))
+		}
+
+		if pattern.Name.Value != "_" {
+			c.emit(pattern, code.OpGetLocal, value.Index)
+			c.storeSymbol(pattern, c.symbolTable.Define(pattern.Name.Value))
+			c.symbolTable.markDefined(pattern.Name.Value)
+		}
+
+		return failPositions, nil
+	case *ast.ValuePattern:
+		c.emit(pattern, code.OpGetLocal, value.Index)
+		if err := c.Compile(pattern.Value); err != nil {
+			return nil, err
+		}
+		c.emit(pattern, code.OpMatchValue)
+
+		return []int{c.emit(pattern, code.OpJumpNotTruthy, 9999)}, nil
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+
+		c.emit(pattern, code.OpGetLocal, value.Index)
+		c.emit(pattern, code.OpMatchArray, len(pattern.Elements), rest)
+		failPositions := []int{c.emit(pattern, code.OpJumpNotTruthy, 9999)}
+
+		for i, el := range pattern.Elements {
+			element := c.symbolTable.defineTemporary()
+			c.emit(el, code.OpGetLocal, value.Index)
+			c.emit(el, code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(el, code.OpIndex)
+			c.emit(el, code.OpSetLocal, element.Index)
+
+			positions, err := c.compilePattern(el, element)
+			if err != nil {
+				return nil, err
+			}
+			failPositions = append(failPositions, positions...)
+
+			c.symbolTable.releaseTemporary(element)
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			c.emit(pattern.Rest, code.OpGetLocal, value.Index)
+			c.emit(pattern.Rest, code.OpRest, len(pattern.Elements))
+			c.storeSymbol(pattern.Rest, c.symbolTable.Define(pattern.Rest.Value))
+			c.symbolTable.markDefined(pattern.Rest.Value)
+		}
+
+		return failPositions, nil
+	case *ast.HashPattern:
+		c.emit(pattern, code.OpGetLocal, value.Index)
+		c.emit(pattern, code.OpMatchType, c.addConstant(&object.String{Value: "HASH"}))
+		failPositions := []int{c.emit(pattern, code.OpJumpNotTruthy, 9999)}
+
+		for _, pair := range pattern.Pairs {
+			// NOTE: キーの式は一度だけ評価する
+			key := c.symbolTable.defineTemporary()
+			if err := c.Compile(pair.Key); err != nil {
+				return nil, err
+			}
+			c.emit(pair.Key, code.OpSetLocal, key.Index)
+
+			c.emit(pair.Key, code.OpGetLocal, value.Index)
+			c.emit(pair.Key, code.OpGetLocal, key.Index)
+			c.emit(pair.Key, code.OpMatchKey)
+			failPositions = append(failPositions, c.emit(pair.Key, code.OpJumpNotTruthy, 9999))
+
+			v := c.symbolTable.defineTemporary()
+			c.emit(pair.Value, code.OpGetLocal, value.Index)
+			c.emit(pair.Value, code.OpGetLocal, key.Index)
+			c.emit(pair.Value, code.OpIndex)
+			c.emit(pair.Value, code.OpSetLocal, v.Index)
+
+			positions, err := c.compilePattern(pair.Value, v)
+			if err != nil {
+				return nil, err
+			}
+			failPositions = append(failPositions, positions...)
+
+			c.symbolTable.releaseTemporary(key)
+			c.symbolTable.releaseTemporary(v)
+		}
+
+		return failPositions, nil
+	}
+
+	return nil, newError(pattern, "unsupported pattern: %s", pattern.String())
+}
@@ -0,0 +1,223 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	builtins       map[string]Symbol
+
+	defined     map[string]bool // コンパイル中の位置で、必ず値が束縛されている名前
+	conditional int             // コンパイル中の`if`の本体の深さ。その中の`let`は実行されるとは限らない
+
+	block       bool     // 関数と同じフレームを使う、ループの本体などのスコープかどうか
+	localNames  []string // フレームのローカル変数の名前（インデックス順に並ぶ）。ブロックのスコープでは使わない
+	temporaries []int    // 使い終わった名前のないローカル変数のインデックス。ブロックのスコープでは使わない
+
+	FreeSymbols []Symbol          // 外側のスコープから取り込んだ自由変数（取り込んだ順に並ぶ）
+	free        map[Symbol]Symbol // 外側のスコープから見た変数から、それを取り込んだ自由変数を引く
+}
+
+// NOTE: 評価器はループの本体でも新しい環境を作るので、名前は別に管理する。
+// ただし変数は外側の関数（トップレベルではメインのフレーム）のローカル変数として確保する
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+
+	return s
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+
+	return s
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:       map[string]Symbol{},
+		builtins:    map[string]Symbol{},
+		defined:     map[string]bool{},
+		FreeSymbols: []Symbol{},
+		free:        map[Symbol]Symbol{},
+	}
+}
+
+// NOTE: 評価器では同じ環境で同じ名前を束縛し直すと同じ変数を書き換えるので、既にあればそれを返す
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	var symbol Symbol
+	if s.Outer == nil {
+		symbol = Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
+		s.numDefinitions++
+	} else {
+		frame := s.frame()
+		symbol = Symbol{Name: name, Index: len(frame.localNames), Scope: LocalScope}
+		frame.localNames = append(frame.localNames, name)
+	}
+
+	s.store[name] = symbol
+
+	return symbol
+}
+
+// NOTE: 組み込み関数は同じ名前のグローバル変数に値がない場合に参照されるので、別に管理する
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.builtins[name] = symbol
+
+	return symbol
+}
+
+// NOTE: プログラムからは参照できない、名前のないローカル変数を確保する。`match`で照らし合わせる値を入れておくのに使う。
+// ローカル変数の数には上限があるので、`releaseTemporary`で返されたものがあれば使い回す
+func (s *SymbolTable) defineTemporary() Symbol {
+	frame := s.frame()
+	if n := len(frame.temporaries); n > 0 {
+		index := frame.temporaries[n-1]
+		frame.temporaries = frame.temporaries[:n-1]
+
+		return Symbol{Index: index, Scope: LocalScope}
+	}
+
+	symbol := Symbol{Index: len(frame.localNames), Scope: LocalScope}
+	frame.localNames = append(frame.localNames, "")
+
+	return symbol
+}
+
+// NOTE: ブロックのスコープで定義した変数（インデックス順）。繰り返しのたびに値を消すのに使う
+func (s *SymbolTable) blockSymbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Index < symbols[j].Index })
+
+	return symbols
+}
+
+// NOTE: ローカル変数を確保するスコープ。ブロックのスコープの外側を、関数かトップレベルまでたどる。
+// トップレベルのブロックで定義した変数は、グローバル変数ではなくメインのフレームのローカル変数になる
+func (s *SymbolTable) frame() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+
+	return s
+}
+
+// NOTE: この先では必ず値が入っている名前として登録する。こうした名前は実行時に外側の束縛を調べずに参照できる
+func (s *SymbolTable) markDefined(name string) {
+	if s.conditional > 0 {
+		return
+	}
+
+	s.defined[name] = true
+}
+
+// NOTE: 定義した順に並べた変数の名前。実行時のエラーメッセージに使う
+func (s *SymbolTable) names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		names[symbol.Index] = name
+	}
+
+	return names
+}
+
+// NOTE: 使い終わった名前のないローカル変数を返す。値は次に使うときに上書きされる
+func (s *SymbolTable) releaseTemporary(symbol Symbol) {
+	frame := s.frame()
+	frame.temporaries = append(frame.temporaries, symbol.Index)
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbols := s.ResolveAll(name)
+	if len(symbols) == 0 {
+		return Symbol{}, false
+	}
+
+	return symbols[0], true
+}
+
+// NOTE: 評価器は実行時に内側の環境から順に名前を探すので、その名前を束縛しうる変数を内側から順にすべて返す。
+// ただし必ず値が入っている変数が見つかれば、それより外側の変数が参照されることはないので、そこで打ち切る
+func (s *SymbolTable) ResolveAll(name string) []Symbol {
+	var symbols []Symbol
+	if symbol, ok := s.store[name]; ok {
+		symbols = append(symbols, symbol)
+
+		if s.defined[name] {
+			return symbols
+		}
+	}
+
+	if s.Outer == nil {
+		if symbol, ok := s.builtins[name]; ok {
+			symbols = append(symbols, symbol)
+		}
+
+		return symbols
+	}
+
+	// NOTE: ブロックの外側の変数は同じフレームにあるので、自由変数にせずにそのまま参照する
+	if s.block {
+		return append(symbols, s.Outer.ResolveAll(name)...)
+	}
+
+	for _, symbol := range s.Outer.ResolveAll(name) {
+		// NOTE: グローバル変数と組み込み関数はどこからでも直接参照できるので、自由変数にしない
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+			symbols = append(symbols, symbol)
+		} else {
+			symbols = append(symbols, s.defineFree(symbol))
+		}
+	}
+
+	return symbols
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	if symbol, ok := s.free[original]; ok {
+		return symbol
+	}
+
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.free[original] = symbol
+
+	return symbol
+}
+
+func (s *SymbolTable) freeNames() []string {
+	names := make([]string, len(s.FreeSymbols))
+	for i, symbol := range s.FreeSymbols {
+		names[i] = symbol.Name
+	}
+
+	return names
+}
@@ -1,132 +1,16 @@
 package evaluator
 
 import (
-	"fmt"
 	"github.com/yasaichi-sandbox/monkey/object"
+	"io"
 )
 
-var builtins = map[string]*object.Builtin{
-	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
+// NOTE: 組み込み関数の表はインタプリタごとに持つので、`puts`の出力先もインタプリタごとに変えられる
+func newBuiltins(out io.Writer) map[string]object.Object {
+	builtins := map[string]object.Object{}
+	for _, def := range object.NewBuiltins(out) {
+		builtins[def.Name] = def.Builtin
+	}
 
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(
-					"argument to `first` must be ARRAY, got %s",
-					args[0].Type(),
-				)
-			}
-
-			array := args[0].(*object.Array)
-			if len(array.Elements) == 0 {
-				return NULL
-			}
-
-			return array.Elements[0]
-		},
-	},
-	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(
-					"argument to `last` must be ARRAY, got %s",
-					args[0].Type(),
-				)
-			}
-
-			array := args[0].(*object.Array)
-			length := len(array.Elements)
-			if length == 0 {
-				return NULL
-			}
-
-			return array.Elements[length-1]
-		},
-	},
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			// NOTE: これ、nilが渡ってきたときにどうするんだ、、
-			switch arg := args[0].(type) {
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			}
-
-			return newError(
-				"argument to `len` not supported, got %s",
-				args[0].Type(),
-			)
-		},
-	},
-	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-
-			// NOTE: 第2引数はどんなオブジェクトでも良いのでチェックの必要はない
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(
-					"argument to `push` must be ARRAY, got %s",
-					args[0].Type(),
-				)
-			}
-
-			array := args[0].(*object.Array)
-			length := len(array.Elements)
-
-			newElements := make([]object.Object, length+1)
-			copy(newElements, array.Elements)
-			newElements[length] = args[1]
-
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"puts": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-
-			return NULL
-		},
-	},
-	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError(
-					"argument to `rest` must be ARRAY, got %s",
-					args[0].Type(),
-				)
-			}
-
-			array := args[0].(*object.Array)
-			length := len(array.Elements)
-			if length == 0 {
-				return NULL
-			}
-
-			// 第2引数がlength, 第3引数がcapacity。capを省略するとlenと同じ値が設定される
-			newElements := make([]object.Object, length-1)
-			// NOTE: この場合ポインタの配列なので、`copy`でdeep copyする必要があるのか謎だった
-			copy(newElements, array.Elements[1:])
-
-			return &object.Array{Elements: newElements}
-		},
-	},
+	return builtins
 }
@@ -1,123 +1,264 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"github.com/yasaichi-sandbox/monkey/ast"
 	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/token"
+	"math"
+	"math/big"
 )
 
+// NOTE: 複合代入演算子と、それが表す二項演算子
+var compoundAssignOperators = map[string]string{
+	"+=": "+",
+	"-=": "-",
+	"*=": "*",
+	"/=": "/",
+}
+
 // NOTE: Goの定数では、構造体を除く値型しか定義できないので`var`を使っている、はず。
 // たぶんコンパイル時に評価して値をスタック領域に詰めないからな気がする、たぶん。
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
 )
 
+// NOTE: 既定の設定のインタプリタで評価する。呼び出しごとに新しいインタプリタを使うので、並行に呼び出してもよい
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return NewInterpreter(Options{}).Eval(node, env)
+}
+
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	return NewInterpreter(Options{Limits: limits}).EvalContext(ctx, node, env)
+}
+
+// NOTE: 1回の評価で共有する状態
+type evaluation struct {
+	interpreter *Interpreter
+	ctx         context.Context
+	limits      Limits
+
+	steps       int
+	allocations int
+}
+
+func (ev *evaluation) evaluate(node ast.Node, env *object.Environment) object.Object {
+	if err := ev.step(); err != nil {
+		err.Pos = node.Pos()
+		return err
+	}
+
+	result := ev.eval(node, env)
+
+	// NOTE: エラーは発生したノードから順に上に伝播していくので、位置が未設定であれば
+	// それが最も内側のノード、つまりエラーが起きた場所になる
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func (ev *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return ev.evalProgram(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return ev.evalBlockStatement(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return ev.evaluate(node.Expression, env)
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
+		// NOTE: 外側のスコープの定数を内側で束縛し直すのは構わない
+		if env.IsLocalConst(node.Name.Value) {
+			return newError("cannot redeclare constant %s", node.Name.Value)
 		}
 
-		env.Set(node.Name.Value, val)
-	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := ev.evaluate(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 
-		return &object.ReturnValue{Value: val}
-	case *ast.CallExpression:
-		function := Eval(node.Function, env) // NOTE: 関数式を評価または識別子に束縛された関数を取得する
-		if isError(function) {
-			return function
+		// NOTE: スタックトレースに表示するため、関数リテラルを束縛した名前を覚えておく
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+				fn.Name = node.Name.Value
+			}
 		}
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		if node.IsConst() {
+			env.SetConst(node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
+	case *ast.ReturnStatement:
+		val := ev.evaluate(node.ReturnValue, env)
+		if isAbrupt(val) {
+			return val
 		}
 
-		return applyFunction(function, args)
+		return &object.ReturnValue{Value: val}
+	case *ast.WhileStatement:
+		return ev.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return ev.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return breakLoop
+	case *ast.ContinueStatement:
+		return continueLoop
+	case *ast.AssignExpression:
+		return ev.evalAssignExpression(node, env)
+	case *ast.CallExpression:
+		return ev.evalCallExpression(node, env, false)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return ev.evalIfExpression(node, env)
+	case *ast.MatchExpression:
+		return ev.evalMatchExpression(node, env)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := ev.evaluate(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return left
+		right := ev.evaluate(node.Right, env)
+		if isAbrupt(right) {
+			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return ev.allocate(EvalInfixExpression(node.Operator, left, right))
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := ev.evaluate(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 
-		return evalPrefixExpression(node.Operator, right)
+		return ev.allocate(EvalPrefixExpression(node.Operator, right))
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := ev.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 
-		return &object.Array{Elements: elements}
+		return ev.allocate(&object.Array{Elements: elements})
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.FunctionLiteral:
-		return &object.Function{
+		return ev.allocate(&object.Function{
 			Parameters: node.Parameters,
 			Body:       node.Body,
 			Env:        env,
-		}
+		})
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return ev.evalHashLiteral(node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return ev.evalIdentifier(node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := ev.evaluate(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := ev.evaluate(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index)
+		// NOTE: 配列やハッシュの要素は既にあるオブジェクトなので、新しく作られる文字列だけを数える
+		result := EvalIndexExpression(left, index)
+		if _, ok := result.(*object.String); ok {
+			return ev.allocate(result)
+		}
+
+		return result
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			return ev.allocate(&object.BigInt{Value: node.Big})
+		}
+
+		return ev.allocate(&object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return ev.allocate(&object.Float{Value: node.Value})
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return ev.allocate(&object.String{Value: node.Value})
+	case *ast.BadStatement, *ast.BadExpression:
+		// NOTE: 構文エラーを含むプログラムは本来評価するべきではないが、念のため
+		return newError("invalid syntax at %s", node.Pos())
 	}
 
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (ev *evaluation) applyFunction(fn object.Object, args []object.Object, depth int) object.Object {
+	// NOTE: 末尾呼び出しはGoのスタックを積まずに、このループで順に実行していく
+	var tailFrames []object.StackFrame
+	var callSite token.Position
+
+	for {
+		result := ev.callFunction(fn, args, depth)
+
+		tc, ok := result.(*tailCall)
+		if !ok {
+			if err, ok := result.(*object.Error); ok {
+				if !err.Pos.IsValid() {
+					err.Pos = callSite
+				}
+
+				for i := len(tailFrames) - 1; i >= 0; i-- {
+					err.Stack = append(err.Stack, tailFrames[i])
+				}
+			}
+
+			return result
+		}
+
+		frame := object.StackFrame{Function: tc.fn.Name, CallSite: tc.callSite}
+		// NOTE: 末尾再帰でループを書くとフレームが際限なく増えるので、同じ呼び出しの繰り返しはまとめ、
+		// それでも多すぎる場合は古いものから捨てる
+		if n := len(tailFrames); n == 0 || tailFrames[n-1] != frame {
+			tailFrames = append(tailFrames, frame)
+		}
+		if len(tailFrames) > maxTailFrames {
+			tailFrames = tailFrames[1:]
+		}
+
+		fn, args, callSite = tc.fn, tc.args, tc.callSite
+	}
+}
+
+func (ev *evaluation) callFunction(fn object.Object, args []object.Object, depth int) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError(
+				"wrong number of arguments. got=%d, want=%d",
+				len(args),
+				len(fn.Parameters),
+			)
+		}
+
+		if maxCallDepth := ev.interpreter.options.MaxCallDepth; maxCallDepth > 0 && depth > maxCallDepth {
+			return newLimitError(object.RECURSION_LIMIT_EXCEEDED, "maximum recursion depth exceeded")
+		}
+
+		// NOTE: 環境とそこに束縛する引数の分を数える
+		if err := ev.charge(1 + len(args)); err != nil {
+			return err
+		}
+
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		extendedEnv.CallDepth = depth
+		evaluated := ev.evalTailBlock(fn.Body, extendedEnv, true)
 
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		// NOTE: 組み込み関数は返す値がない場合にnilを返す。戻り値は新しく作られたものとみなす
+		if result := fn.Fn(args...); result != nil {
+			return ev.allocate(result)
+		}
+
+		return NULL
 	}
 
 	return newError("not a function: %s", fn.Type())
@@ -134,6 +275,66 @@ func evalArrayIndexExpression(left, index object.Object) object.Object {
 	return elements[i]
 }
 
+func (ev *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		// NOTE: 代入は既にある束縛を書き換えるだけで、新しく変数を作ることはしない
+		current, ok := env.Get(target.Value)
+		if !ok {
+			return newError("identifier not found: %s", target.Value)
+		}
+		if env.IsConst(target.Value) {
+			return newError("cannot assign to constant %s", target.Value)
+		}
+
+		value := ev.evalAssignedValue(node, current, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		env.Assign(target.Value, value)
+
+		return value
+	case *ast.IndexExpression:
+		left := ev.evaluate(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+
+		index := ev.evaluate(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if node.Operator != "=" {
+			current = EvalIndexExpression(left, index)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		value := ev.evalAssignedValue(node, current, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		return ev.evalIndexAssignment(left, index, value)
+	}
+
+	return newError("cannot assign to %s", node.Target.String())
+}
+
+// NOTE: 代入する値。複合代入の場合は`current`と右辺を演算した結果になる
+func (ev *evaluation) evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	value := ev.evaluate(node.Value, env)
+	if isAbrupt(value) || node.Operator == "=" {
+		return value
+	}
+
+	return ev.allocate(EvalInfixExpression(compoundAssignOperators[node.Operator], current, value))
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -148,17 +349,58 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	return FALSE
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return object.NewInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return object.NewInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return object.NewInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+
+		// NOTE: int64の`/`と同じく0の方向に丸める
+		return object.NewInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("modulo by zero")
+		}
+
+		// NOTE: int64の`%`と同じく結果の符号は左オペランドと同じになる
+		return object.NewInteger(new(big.Int).Rem(leftVal, rightVal))
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	}
+
+	return newError(
+		"unknown operator: %s %s %s",
+		left.Type(), operator, right.Type(),
+	)
+}
+
+func (ev *evaluation) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = ev.evaluate(statement, env)
 		if result == nil { // NOTE: この`nil`チェックは近いうちに消される気がする
 			continue
 		}
 
-		switch result.Type() {
-		case object.ERROR_OBJ, object.RETURN_VALUE_OBJ:
+		switch result.(type) {
+		case *object.Error, *object.ReturnValue, *loopControl:
 			return result
 		}
 	}
@@ -166,12 +408,40 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (ev *evaluation) evalCallExpression(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	function := ev.evaluate(node.Function, env) // NOTE: 関数式を評価または識別子に束縛された関数を取得する
+	if isAbrupt(function) {
+		return function
+	}
+
+	args := ev.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isAbrupt(args[0]) {
+		return args[0]
+	}
+
+	fn, ok := function.(*object.Function)
+	if ok && tail {
+		return &tailCall{fn: fn, args: args, callSite: node.Pos()}
+	}
+
+	// NOTE: 末尾呼び出しは呼び出し元の関数を置き換えるだけなので、深さは変わらない
+	result := ev.applyFunction(function, args, env.CallDepth+1)
+	if err, ok := result.(*object.Error); ok && fn != nil {
+		err.Stack = append(err.Stack, object.StackFrame{
+			Function: fn.Name,
+			CallSite: node.Pos(),
+		})
+	}
+
+	return result
+}
+
+func (ev *evaluation) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	result := []object.Object{}
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		evaluated := ev.evaluate(e, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 
@@ -181,26 +451,75 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+func (ev *evaluation) evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := ev.evaluate(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = iterable.Elements
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			items = append(items, pair.Key)
+		}
+	case *object.String:
+		// NOTE: 添字と同じく、文字（rune）単位で取り出す
+		for _, r := range iterable.Value {
+			items = append(items, &object.String{Value: string(r)})
+		}
+
+		if err := ev.charge(len(items)); err != nil {
+			return err
+		}
+	default:
+		err := newError("cannot iterate over %s", iterable.Type())
+		err.Pos = node.Iterable.Pos()
+		return err
+	}
+
+	for _, item := range items {
+		// NOTE: 本体で作った関数がその回の値を捕まえられるように、繰り返しごとに新しい環境を作る
+		if err := ev.charge(2); err != nil {
+			return err
+		}
+
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.CallDepth = env.CallDepth
+		loopEnv.Set(node.Variable.Value, item)
+
+		result := ev.evaluate(node.Body, loopEnv)
+		if result, stop := loopResult(result); stop {
+			return result
+		}
+	}
+
+	return NULL
+}
+
 func evalHashIndexExpression(left, index object.Object) object.Object {
 	hashable, ok := index.(object.Hashable)
 	if !ok {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := left.(*object.Hash).Pairs[hashable.HashKey()]
+	value, ok := left.(*object.Hash).Get(hashable)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair, len(node.Pairs))
+func (ev *evaluation) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := &object.Hash{}
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+	// NOTE: キーと値は書かれた順に評価する
+	for _, pair := range node.Pairs {
+		key := ev.evaluate(pair.Key, env)
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -209,59 +528,115 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := ev.evaluate(pair.Value, env)
+		if isAbrupt(value) {
 			return value
 		}
 
-		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashable, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return ev.allocate(hash)
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (ev *evaluation) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := ev.interpreter.builtins[node.Value]; ok {
 		return builtin
 	}
 
 	return newError("identifier not found: %s", node.Value)
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+func (ev *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := ev.evaluate(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return ev.evaluate(ie.Consequence, env)
 	} else if ie.Alternative == nil {
 		return NULL
 	} else {
-		return Eval(ie.Alternative, env)
+		return ev.evaluate(ie.Alternative, env)
+	}
+}
+
+func (ev *evaluation) evalIndexAssignment(left, index, value object.Object) object.Object {
+	// NOTE: ハッシュに新しいキーが増えた場合は、割り当てとして数える
+	hash, isHash := left.(*object.Hash)
+	length := 0
+	if isHash {
+		length = hash.Len()
+	}
+
+	result := EvalIndexAssignment(left, index, value)
+	if isHash && hash.Len() > length {
+		if err := ev.charge(1); err != nil {
+			return err
+		}
+	}
+
+	return result
+}
+
+// NOTE: VMでも同じ結果になるように、添字への代入もVMから使う
+func EvalIndexAssignment(left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		// NOTE: 読み出しと違って、範囲外への代入はNULLにせずエラーにする
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", i.Value)
+		}
+
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		hashable, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		left.Set(hashable, value)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
 	}
+
+	return value
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+// NOTE: VMでも同じ結果になるように、演算の定義はVMからも使う
+func EvalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	}
 
 	return newError("index operator not supported: %s", left.Type())
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+// NOTE: VMでも同じ結果になるように、演算の定義はVMからも使う
+func EvalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	// NOTE: 整数と小数の演算では、整数を小数に変換してから計算する
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -288,19 +663,85 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	)
 }
 
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	// NOTE: 整数と小数の比較は、整数を小数に変換すると丸められることがあるので、`object.Equal`と同じく丸めずに比べる
+	if left.Type() != right.Type() {
+		if result, ok := evalNumberComparison(operator, left, right); ok {
+			return result
+		}
+	}
+
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	}
+
+	return newError(
+		"unknown operator: %s %s %s",
+		left.Type(), operator, right.Type(),
+	)
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	// NOTE: 桁あふれする場合は多倍長整数で計算し直す
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		if result := leftVal + rightVal; (result > leftVal) == (rightVal > 0) {
+			return &object.Integer{Value: result}
+		}
+
+		return evalBigIntInfixExpression(operator, left, right)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		if result := leftVal - rightVal; (result < leftVal) == (rightVal > 0) {
+			return &object.Integer{Value: result}
+		}
+
+		return evalBigIntInfixExpression(operator, left, right)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		result := leftVal * rightVal
+		if leftVal == 0 || result/leftVal == rightVal && !(leftVal == -1 && rightVal == math.MinInt64) {
+			return &object.Integer{Value: result}
+		}
+
+		return evalBigIntInfixExpression(operator, left, right)
 	case "/":
+		// NOTE: Goでは0除算はpanicになってしまうので、Monkeyのエラーとして返す
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntInfixExpression(operator, left, right)
+		}
+
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+
+		return &object.Integer{Value: leftVal % rightVal}
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "<":
@@ -317,16 +758,57 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	)
 }
 
+func (ev *evaluation) evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	body, armEnv, abrupt := ev.selectMatchArm(node, env)
+	if abrupt != nil {
+		return abrupt
+	}
+
+	// NOTE: 空のブロックや`let`で終わるブロックの腕は値を持たないので、`null`にする
+	if result := ev.evaluate(body, armEnv); result != nil {
+		return result
+	}
+
+	return NULL
+}
+
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		// NOTE: -math.MinInt64はint64に収まらない
+		if right.Value == math.MinInt64 {
+			return object.NewInteger(new(big.Int).Neg(toBigInt(right)))
+		}
+
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return object.NewInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return newError("unknown operator: -%s", right.Type())
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+// NOTE: VMでも同じ結果になるように、演算の定義はVMからも使う
+func evalNumberComparison(operator string, left, right object.Object) (object.Object, bool) {
+	cmp, comparable := object.CompareNumbers(left, right)
+
+	switch operator {
+	case ">":
+		return nativeBoolToBooleanObject(comparable && cmp > 0), true
+	case "<":
+		return nativeBoolToBooleanObject(comparable && cmp < 0), true
+	case "==":
+		return nativeBoolToBooleanObject(comparable && cmp == 0), true
+	case "!=":
+		return nativeBoolToBooleanObject(!comparable || cmp != 0), true
+	}
+
+	return nil, false
+}
+
+func EvalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
@@ -337,11 +819,11 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	return newError("unknown operator: %s%s", operator, right.Type())
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (ev *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = ev.evaluate(statement, env)
 
 		switch result := result.(type) {
 		case *object.Error:
@@ -368,6 +850,153 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// NOTE: 配列と同じく、文字（rune）単位でインデックスを数える
+func evalStringIndexExpression(left, index object.Object) object.Object {
+	runes := []rune(left.(*object.String).Value)
+	i := index.(*object.Integer).Value
+
+	if i < 0 || i >= int64(len(runes)) {
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[i])}
+}
+
+// NOTE: 関数本体のブロックを評価する。`tail`が真の場合、最後の文は関数の戻り値になる位置にある。
+// `return`する値は常に関数の戻り値なので、`tail`に関わらず末尾位置として扱う
+func (ev *evaluation) evalTailBlock(block *ast.BlockStatement, env *object.Environment, tail bool) object.Object {
+	var result object.Object
+
+	for i, statement := range block.Statements {
+		last := i == len(block.Statements)-1
+
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			val := ev.evalTailExpression(statement.ReturnValue, env, true)
+			if isAbrupt(val) {
+				return val
+			}
+
+			return &object.ReturnValue{Value: val}
+		case *ast.ExpressionStatement:
+			result = ev.evalTailExpression(statement.Expression, env, tail && last)
+		default:
+			result = ev.evaluate(statement, env)
+		}
+
+		switch result.(type) {
+		case *object.Error, *object.ReturnValue, *loopControl, *tailCall:
+			return result
+		}
+	}
+
+	return result
+}
+
+func (ev *evaluation) evalTailExpression(node ast.Expression, env *object.Environment, tail bool) object.Object {
+	var result object.Object
+
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		result = ev.evalCallExpression(node, env, tail)
+	case *ast.IfExpression:
+		condition := ev.evaluate(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			result = ev.evalTailBlock(node.Consequence, env, tail)
+		} else if node.Alternative == nil {
+			result = NULL
+		} else {
+			result = ev.evalTailBlock(node.Alternative, env, tail)
+		}
+	case *ast.MatchExpression:
+		body, armEnv, abrupt := ev.selectMatchArm(node, env)
+		if abrupt != nil {
+			result = abrupt
+		} else if block, ok := body.(*ast.BlockStatement); ok {
+			if result = ev.evalTailBlock(block, armEnv, tail); result == nil {
+				result = NULL
+			}
+		} else {
+			result = ev.evalTailExpression(body.(ast.Expression), armEnv, tail)
+		}
+	default:
+		return ev.evaluate(node, env)
+	}
+
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func (ev *evaluation) evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := ev.evaluate(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		// NOTE: `for`と同じく、本体は繰り返しごとに新しい環境で評価する
+		if err := ev.charge(1); err != nil {
+			return err
+		}
+
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.CallDepth = env.CallDepth
+
+		result := ev.evaluate(node.Body, loopEnv)
+		if result, stop := loopResult(result); stop {
+			return result
+		}
+	}
+}
+
+// NOTE: 値に一致する最初の腕の式と、パターンで束縛した名前を含む環境を返す。
+// どの腕にも一致しなければエラーを返す
+func (ev *evaluation) selectMatchArm(node *ast.MatchExpression, env *object.Environment) (ast.Node, *object.Environment, object.Object) {
+	subject := ev.evaluate(node.Subject, env)
+	if isAbrupt(subject) {
+		return nil, nil, subject
+	}
+
+	for _, arm := range node.Arms {
+		// NOTE: 一致しなかった腕で束縛した名前が残らないように、腕ごとに環境を作る
+		armEnv := object.NewEnclosedEnvironment(env)
+		armEnv.CallDepth = env.CallDepth
+
+		matched, abrupt := ev.matchPattern(arm.Pattern, subject, armEnv)
+		if abrupt != nil {
+			return nil, nil, abrupt
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := ev.evaluate(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return nil, nil, guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return arm.Body, armEnv, nil
+	}
+
+	return nil, nil, newError("no match arm for %s: %s", subject.Type(), subject.Inspect())
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
@@ -378,19 +1007,51 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviro
 	return env
 }
 
-func isError(obj object.Object) bool {
-	// NOTE: interfaceに対するnilチェックをせずにメソッド呼び出しを書きがちなので気をつけたい
-	if obj == nil {
-		return false
+// NOTE: 評価を打ち切って外側に伝える値。エラーだけでなく、式の中で実行された`return`、`break`、`continue`も、
+// その式の値として使わずにそのまま伝える
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *loopControl:
+		return true
+	}
+
+	return false
+}
+
+func isInteger(obj object.Object) bool {
+	switch obj.Type() {
+	case object.INTEGER_OBJ, object.BIGINT_OBJ:
+		return true
 	}
 
-	return obj.Type() == object.ERROR_OBJ
+	return false
+}
+
+func isNumber(obj object.Object) bool {
+	return isInteger(obj) || obj.Type() == object.FLOAT_OBJ
 }
 
 func isTruthy(obj object.Object) bool {
 	return obj != FALSE && obj != NULL
 }
 
+// NOTE: ループの本体を1回評価した結果から、ループを抜けるかどうかを決める。
+// `break`ならループの値としてNULLを返し、エラーと`return`はそのまま外に伝える
+func loopResult(result object.Object) (object.Object, bool) {
+	switch result := result.(type) {
+	case *loopControl:
+		if result.continues {
+			return nil, false
+		}
+
+		return NULL, true
+	case *object.Error, *object.ReturnValue:
+		return result, true
+	}
+
+	return nil, false
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -403,6 +1064,31 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	}
+
+	return nil
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	}
+
+	return math.NaN()
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
@@ -1,11 +1,20 @@
 package evaluator_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/yasaichi-sandbox/monkey/ast"
 	"github.com/yasaichi-sandbox/monkey/evaluator"
 	"github.com/yasaichi-sandbox/monkey/lexer"
 	"github.com/yasaichi-sandbox/monkey/object"
 	"github.com/yasaichi-sandbox/monkey/parser"
+	"math"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -87,6 +96,51 @@ func TestArrayLiterals(t *testing.T) {
 	testIntegerObject(t, result.Elements[2], 6)
 }
 
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x = 2; x", "2"},
+		{"let x = 1; x = x + 1", "2"},
+		{"let a = 1; let b = 2; a = b = 3; a + b", "6"},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", "6"},
+		{`let s = "mon"; s += "key"; s`, "monkey"},
+		{"let x = 9223372036854775807; x += 1; x", "9223372036854775808"},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", "3"},
+		{"let n = 0; let inc = fn() { n = n + 1; }; inc(); inc(); n", "2"},
+		{"let n = 0; let f = fn(n) { n = 5 }; f(1); n", "0"},
+		{"let total = 0; for (x in [1, 2, 3]) { total += x } total", "6"},
+		{"let i = 0; while (i < 3) { i += 1 } i", "3"},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr", "[1, 20, 3]"},
+		{"let arr = [1, 2, 3]; arr[2] *= 10; arr[2]", "30"},
+		{"let a = [1]; let b = a; b[0] = 2; a", "[2]"},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h`, "{a:11, b:2}"},
+		{`let h = {}; h[[1][0]] = "one"; h`, "{1:one}"},
+		{"let a = [1, 2]; a[0] = a; a", "[[...], 2]"},
+		{`let h = {}; h["self"] = h; [h]`, "[{self:{...}}]"},
+		{"let a = [1]; let b = [a, a]; b", "[[1], [1]]"},
+		{"let a = [1, 2]; a[0] = a; json_encode(a)", "ERROR: 1:27: cannot encode cyclic ARRAY as JSON"},
+		{"x = 1", "ERROR: 1:1: identifier not found: x"},
+		{"let f = fn() { y = 1 }; f()", "ERROR: 1:16: identifier not found: y\n\tat f (called at 1:25)"},
+		{"len = 1", "ERROR: 1:1: identifier not found: len"},
+		{"let x = 1; x += true", "ERROR: 1:12: type mismatch: INTEGER + BOOLEAN"},
+		{"let arr = [1]; arr[1] = 2", "ERROR: 1:16: index out of range: 1"},
+		{"let arr = [1]; arr[-1] = 2", "ERROR: 1:16: index out of range: -1"},
+		{`let arr = [1]; arr["0"] = 2`, "ERROR: 1:16: array index must be INTEGER, got STRING"},
+		{`let h = {}; h[fn() {}] = 1`, "ERROR: 1:13: unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "ERROR: 1:16: index assignment not supported: STRING"},
+		{`let h = {}; h["a"] += 1`, "ERROR: 1:13: type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -106,6 +160,59 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestBigIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"9223372036854775807 * 2", "18446744073709551614"},
+		{"4611686018427387904 * -2", int64(-9223372036854775808)},
+		{"-9223372036854775807 - 1", int64(-9223372036854775808)},
+		{"let min = -9223372036854775807 - 1; -min", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; min / -1", "9223372036854775808"},
+		{"-9223372036854775808", int64(-9223372036854775808)},
+		{"99999999999999999999 - 99999999999999999998", int64(1)},
+		{"99999999999999999999 / 3", "33333333333333333333"},
+		{"99999999999999999999 > 1", true},
+		{"99999999999999999999 == 99999999999999999999", true},
+		{"99999999999999999999 == 1", false},
+		{"int(1e20)", "100000000000000000000"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"99999999999999999999 + 0.5", 1e20},
+		{`{99999999999999999999: 5}[99999999999999999998 + 1]`, int64(5)},
+		{`{100000000000000000000: 5}[1e20]`, int64(5)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			bigInt, ok := evaluated.(*object.BigInt)
+			if !ok {
+				t.Errorf("object is not BigInt. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if bigInt.Value.String() != expected {
+				t.Errorf(
+					"object has wrong value. got=%s, want=%s",
+					bigInt.Value,
+					expected,
+				)
+			}
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -114,6 +221,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("こんにちは")`, 5},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
@@ -129,6 +237,14 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
 		{`puts("hello", "world!")`, nil},
+		{`int(3.9)`, 3},
+		{`int(-3.9)`, -3},
+		{`int("42")`, 42},
+		{`int("4.2")`, `could not convert "4.2" to INTEGER`},
+		{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+		{`float(3)`, 3.0},
+		{`float("2.5")`, 2.5},
+		{`float("abc")`, `could not convert "abc" to FLOAT`},
 	}
 
 	for _, tt := range tests {
@@ -137,6 +253,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
 		case nil:
 			testNullObject(t, evaluated)
 		case string:
@@ -189,6 +307,31 @@ func TestClosures(t *testing.T) {
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const a = 5; a * 2", "10"},
+		{"const a = 5; let f = fn() { let a = 1; a += 1; a }; f() + a", "7"},
+		{"let a = 1; const a = 2; a", "2"},
+		{"const a = 1; let f = fn() { a = 2 }; f()", "ERROR: 1:29: cannot assign to constant a\n\tat f (called at 1:38)"},
+		{"let f = fn() { a += 1 }; const a = 1; f()", "ERROR: 1:16: cannot assign to constant a\n\tat f (called at 1:39)"},
+		{"const a = 1; let a = 2;", "ERROR: 1:14: cannot redeclare constant a"},
+		{"const a = 1; const a = 2;", "ERROR: 1:14: cannot redeclare constant a"},
+		// NOTE: `for`と同じく、`while`の本体も繰り返しごとに新しい環境になるので再宣言にはならない
+		{"let i = 0; while (i < 2) { const x = i; i += 1 } i", "2"},
+		{"for (i in [1, 2]) { const x = i; } 1", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -234,6 +377,30 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"5 % 0",
+			"modulo by zero",
+		},
+		{
+			"99999999999999999999 / 0",
+			"division by zero",
+		},
+		{
+			"99999999999999999999 % 0",
+			"modulo by zero",
+		},
+		{
+			"1 + (true + false);",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"fn() { 1 + true }();",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
 		{
 			`"Hello" - "World"`,
 			"unknown operator: STRING - STRING",
@@ -242,6 +409,14 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"fn(x) { x }(1, 2);",
+			"wrong number of arguments. got=2, want=1",
+		},
+		{
+			"1(2);",
+			"not a function: INTEGER",
+		},
 	}
 
 	for _, tt := range tests {
@@ -262,6 +437,73 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositionAndStackTrace(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+let apply = fn(f) {
+  f(1, "two")
+};
+apply(add);`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Pos.String() != "2:3" {
+		t.Errorf("wrong error position. expected=%q, got=%q", "2:3", errObj.Pos)
+	}
+
+	expectedStack := []struct {
+		function string
+		callSite string
+	}{
+		{"add", "5:3"},
+		{"apply", "7:1"},
+	}
+
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf(
+			"wrong stack length. expected=%d, got=%d",
+			len(expectedStack),
+			len(errObj.Stack),
+		)
+	}
+
+	for i, expected := range expectedStack {
+		frame := errObj.Stack[i]
+		if frame.Function != expected.function {
+			t.Errorf(
+				"errObj.Stack[%d].Function wrong. expected=%q, got=%q",
+				i,
+				expected.function,
+				frame.Function,
+			)
+		}
+		if frame.CallSite.String() != expected.callSite {
+			t.Errorf(
+				"errObj.Stack[%d].CallSite wrong. expected=%q, got=%q",
+				i,
+				expected.callSite,
+				frame.CallSite,
+			)
+		}
+	}
+
+	expectedInspect := "ERROR: 2:3: type mismatch: INTEGER + STRING\n" +
+		"\tat add (called at 5:3)\n" +
+		"\tat apply (called at 7:1)"
+	if errObj.Inspect() != expectedInspect {
+		t.Errorf(
+			"wrong errObj.Inspect(). expected=%q, got=%q",
+			expectedInspect,
+			errObj.Inspect(),
+		)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -294,6 +536,120 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestEvalContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		ctx          context.Context
+		limits       evaluator.Limits
+		input        string
+		expectedKind object.ErrorKind
+	}{
+		{
+			context.Background(),
+			evaluator.Limits{MaxSteps: 100, MaxAllocations: 100},
+			"let add = fn(a, b) { a + b }; add(1, 2);",
+			"",
+		},
+		{
+			canceled,
+			evaluator.Limits{},
+			"1 + 2",
+			object.CANCELED,
+		},
+		{
+			expired,
+			evaluator.Limits{},
+			"let loop = fn() { loop() }; loop();",
+			object.DEADLINE_EXCEEDED,
+		},
+		{
+			context.Background(),
+			evaluator.Limits{MaxSteps: 1000},
+			"let loop = fn() { loop() }; loop();",
+			object.STEP_LIMIT_EXCEEDED,
+		},
+		{
+			context.Background(),
+			evaluator.Limits{MaxAllocations: 1000},
+			"let grow = fn(arr) { grow(push(arr, 1)) }; grow([]);",
+			object.ALLOCATION_LIMIT_EXCEEDED,
+		},
+		{
+			context.Background(),
+			evaluator.Limits{MaxAllocations: 1000},
+			`let double = fn(s) { double(s + s) }; double("a");`,
+			object.ALLOCATION_LIMIT_EXCEEDED,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := evaluator.EvalContext(tt.ctx, testParse(tt.input), object.NewEnvironment(), tt.limits)
+
+		if tt.expectedKind == "" {
+			testIntegerObject(t, evaluated, 3)
+			continue
+		}
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind. expected=%q, got=%q", tt.expectedKind, errObj.Kind)
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 1e-1", 0.2},
+		{"1.5 - 3", -1.5},
+		{"7.5 % 2", 1.5},
+		{"1 / 0.0 > 1e308", true},
+		{"1.5 < 2", true},
+		{"2 > 2.5", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.1 + 0.2 == 0.3", false},
+		// NOTE: 2^53より大きい整数は小数に変換すると丸められるので、丸めずに比べる
+		{"9007199254740993 == 9007199254740992.0", false},
+		{"9007199254740993 != 9007199254740992.0", true},
+		{"9007199254740993 > 9007199254740992.0", true},
+		{"9007199254740992.0 < 9007199254740993", true},
+		{"99999999999999999999 == 1e20", false},
+		{"100000000000000000000 == 1e20", true},
+		{"1 == 0.0 / 0.0", false},
+		{"1 != 0.0 / 0.0", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestEvalIntegerExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -314,6 +670,12 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 + 10 % 4 * 3", 8},
+		{"let min = -9223372036854775807 - 1; min % -1", 0},
+		{"99999999999999999999 % 10", 9},
 	}
 
 	for _, tt := range tests {
@@ -410,6 +772,14 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.5: 5}[2.5]`,
+			5,
+		},
 	}
 
 	for _, tt := range tests {
@@ -424,6 +794,24 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestHashLiteralEvaluationOrder(t *testing.T) {
+	input := `
+	let log = fn(s) { puts(s); s };
+	{log("k1"): log("v1"), log("k2"): log("v2"), "k3": log("v3")}`
+
+	var out bytes.Buffer
+	interpreter := evaluator.NewInterpreter(evaluator.Options{Stdout: &out})
+	evaluated := interpreter.Eval(testParse(input), object.NewEnvironment())
+	if _, ok := evaluated.(*object.Error); ok {
+		t.Fatalf("Eval returned an error: %s", evaluated.Inspect())
+	}
+
+	expected := "k1\nv1\nk2\nv2\nv3\n"
+	if out.String() != expected {
+		t.Errorf("keys and values are evaluated in wrong order. expected=%q, got=%q", expected, out.String())
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `
 	let two = "two";
@@ -442,26 +830,35 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		evaluator.TRUE.HashKey():                   5,
-		evaluator.FALSE.HashKey():                  6,
+	// NOTE: ペアはリテラルに書かれた順に並ぶ
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{evaluator.TRUE, 5},
+		{evaluator.FALSE, 6},
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for i, pair := range result.Pairs() {
+		if pair.Key.(object.Hashable).HashKey() != expected[i].key.HashKey() {
+			t.Errorf("pair %d has wrong key. want=%s, got=%s", i, expected[i].key.Inspect(), pair.Key.Inspect())
+		}
+
+		value, ok := result.Get(expected[i].key)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
+			continue
 		}
 
-		testIntegerObject(t, pair.Value, expectedValue)
+		testIntegerObject(t, value, expected[i].value)
 	}
 }
 
@@ -478,6 +875,9 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
 	}
 
 	for _, tt := range tests {
@@ -491,6 +891,172 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestInterpreterDefine(t *testing.T) {
+	interpreter := evaluator.NewInterpreter(evaluator.Options{})
+
+	definitions := map[string]interface{}{
+		"answer": &object.Integer{Value: 42},
+		"twice": func(args ...object.Object) object.Object {
+			return &object.Array{Elements: []object.Object{args[0], args[0]}}
+		},
+		"greet": func(n int64, name string) (string, error) {
+			if n < 0 {
+				return "", errors.New("n must not be negative")
+			}
+
+			return strings.Repeat("hello ", int(n)) + name, nil
+		},
+		"primes": []int{2, 3, 5},
+		"config": struct {
+			Name string `monkey:"name"`
+		}{"monkey"},
+		"total": func(xs []int) int {
+			total := 0
+			for _, x := range xs {
+				total += x
+			}
+
+			return total
+		},
+	}
+
+	for name, value := range definitions {
+		if err := interpreter.Define(name, value); err != nil {
+			t.Fatalf("Define(%q) returned an error: %s", name, err)
+		}
+	}
+
+	if err := interpreter.Define("invalid", func(c chan int) {}); err == nil {
+		t.Errorf("Define did not return an error for an unsupported function")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"answer + 1", "43"},
+		{"len(twice(1))", "2"},
+		{`greet(2, "monkey")`, "hello hello monkey"},
+		{`greet(-1, "monkey")`, "ERROR: 1:1: n must not be negative"},
+		{`greet("monkey")`, "ERROR: 1:1: wrong number of arguments. got=1, want=2"},
+		{`greet("2", "monkey")`, "ERROR: 1:1: argument 1 to `greet` must be INTEGER, got STRING"},
+		{"total(push(primes, 7))", "17"},
+		{`config["name"]`, "monkey"},
+		{`total([1, "2"])`, "ERROR: 1:1: argument 1 to `total`: cannot convert STRING to int"},
+	}
+
+	for _, tt := range tests {
+		evaluated := interpreter.Eval(testParse(tt.input), object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// NOTE: 他のインタプリタには影響しない
+	if _, ok := testEval("answer").(*object.Error); !ok {
+		t.Errorf("answer is defined in another interpreter")
+	}
+}
+
+func TestInterpreterRun(t *testing.T) {
+	tests := []struct {
+		input          string
+		expected       interface{}
+		expectedStdout string
+		expectedStderr string
+		warnShadowing  bool
+	}{
+		{`puts("hello", 1); 2`, 2, "hello\n1\n", "", false},
+		{"let x = ;", nil, "", "test.monkey:1:9: no prefix parse function for ; found\n", false},
+		{"const x = 1; x = 2;", nil, "", "test.monkey:1:14: cannot assign to constant x\n", false},
+		{"let x = 1; let f = fn() { let x = 2; x }; f()", 2, "", "", false},
+		{"let x = 1; let f = fn() { let x = 2; x }; f()", 2, "", "test.monkey:1:31: x shadows a binding in an outer scope\n", true},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		interpreter := evaluator.NewInterpreter(evaluator.Options{
+			Stdout:        &stdout,
+			Stderr:        &stderr,
+			WarnShadowing: tt.warnShadowing,
+		})
+
+		evaluated := interpreter.Run(context.Background(), "test.monkey", tt.input, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			if evaluated != nil {
+				t.Errorf("object is not nil. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("wrong stdout. expected=%q, got=%q", tt.expectedStdout, stdout.String())
+		}
+
+		if stderr.String() != tt.expectedStderr {
+			t.Errorf("wrong stderr. expected=%q, got=%q", tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestInterpretersRunConcurrently(t *testing.T) {
+	input := `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	puts(fib(15));
+	`
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 8)
+
+	for i := range outputs {
+		wg.Add(1)
+
+		go func(out *bytes.Buffer) {
+			defer wg.Done()
+
+			interpreter := evaluator.NewInterpreter(evaluator.Options{Stdout: out})
+			interpreter.Run(context.Background(), "", input, object.NewEnvironment())
+		}(&outputs[i])
+	}
+
+	wg.Wait()
+
+	for i, out := range outputs {
+		if out.String() != "610\n" {
+			t.Errorf("outputs[%d] wrong. expected=%q, got=%q", i, "610\n", out.String())
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_encode({"name": "monkey", "tags": [1, 2.5, true, first([])]})`, `{"name":"monkey","tags":[1,2.5,true,null]}`},
+		{`json_encode([{"b": 1, "a": 2}], true)`, "[\n  {\n    \"a\": 2,\n    \"b\": 1\n  }\n]"},
+		{`json_decode("{\"xs\": [1, 2, 3]}")["xs"][2]`, "3"},
+		{`let v = {"a": [1, {"b": first([])}]}; json_encode(json_decode(json_encode(v)))`, `{"a":[1,{"b":null}]}`},
+		{`json_encode(fn(x) { x })`, "ERROR: 1:1: cannot encode FUNCTION as JSON"},
+		{`json_encode({"f": len})`, "ERROR: 1:1: cannot encode BUILTIN as JSON"},
+		{`json_encode({1: 2})`, "ERROR: 1:1: cannot encode hash key INTEGER as JSON, keys must be STRING"},
+		{`json_encode(1, "pretty")`, "ERROR: 1:1: second argument to `json_encode` must be BOOLEAN, got STRING"},
+		{`json_encode()`, "ERROR: 1:1: wrong number of arguments. got=0, want=1 or 2"},
+		{`json_decode("[1,")`, "ERROR: 1:1: could not decode JSON: unexpected end of JSON input"},
+		{`json_decode(1)`, "ERROR: 1:1: argument to `json_decode` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -507,6 +1073,170 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input          string
+		expected       string
+		expectedOutput string
+	}{
+		{"let i = 0; while (i < 5) { i += 1 } i", "5", ""},
+		{"while (false) { 1 }", "null", ""},
+		{"let i = 0; while (true) { if (i == 3) { break; } i += 1 } i", "3", ""},
+		{"let i = 0; let s = 0; while (i < 5) { i += 1; if (i == 2) { continue; } s += i } s", "13", ""},
+		{"for (x in [1, 2, 3]) { puts(x) }", "null", "1\n2\n3\n"},
+		{`for (k in {"b": 1, "a": 2}) { puts(k) }`, "null", "b\na\n"},
+		{`for (c in "日本") { puts(c) }`, "null", "日\n本\n"},
+		{"for (x in [1, 2, 3, 4]) { if (x == 2) { continue } if (x == 4) { break } puts(x) }", "null", "1\n3\n"},
+		{"for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y > x) { break } puts(x * 10 + y) } }", "null", "11\n21\n22\n"},
+		{"let find = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; find([1, 5, 7])", "5", ""},
+		{"let find = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; find([])", "-1", ""},
+		{"let x = 10; for (x in [1]) { puts(x) } x", "10", "1\n"},
+		{"let f = fn(n) { while (true) { if (n > 2) { break } n += 1 } n }; f(0)", "3", ""},
+		{"let r = 0; while (true) { let x = if (true) { break; }; r = 1 } r", "0", ""},
+		{"let a = [1]; for (x in [1, 2]) { a = push(a, if (x == 1) { continue; } else { x }) } a", "[1, 2]", ""},
+		{"let i = 0; while (i < 2) { let y = i; i += 1 } y", "ERROR: 1:48: identifier not found: y", ""},
+		{"let fs = []; let i = 0; while (i < 2) { let j = i; fs = push(fs, fn() { j }); i += 1 } [fs[0](), fs[1]()]", "[0, 1]", ""},
+		{"let f = fn() { for (x in [1]) { let y = [if (true) { return x * 2 }] } 0 }; f()", "2", ""},
+		{"for (x in 5) { x }", "ERROR: 1:11: cannot iterate over INTEGER", ""},
+		{"while (true) { 1 + true }", "ERROR: 1:16: type mismatch: INTEGER + BOOLEAN", ""},
+		{"for (x in [1]) { y }", "ERROR: 1:18: identifier not found: y", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		interpreter := evaluator.NewInterpreter(evaluator.Options{Stdout: &out})
+
+		evaluated := interpreter.Eval(testParse(tt.input), object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+
+		if out.String() != tt.expectedOutput {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expectedOutput, out.String())
+		}
+	}
+
+	// NOTE: 終わらないループも評価ステップの上限で止められる
+	limits := evaluator.Limits{MaxSteps: 1000}
+	evaluated := evaluator.EvalContext(context.Background(), testParse("while (true) { }"), object.NewEnvironment(), limits)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Kind != object.STEP_LIMIT_EXCEEDED {
+		t.Errorf("infinite loop was not stopped. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match (5) { 1 => "one", 2 => "two", _ => "many" }`, "many"},
+		{`match ("a") { "b" => 1, "a" => 2 }`, "2"},
+		{`match (true) { false => 0, true => 1 }`, "1"},
+		{`match (1.0) { 1 => "int", }`, "int"},
+		{`let x = 3; match (x * 2) { (x + x) => "double" }`, "double"},
+		{`match (first([])) { 0 => 1, _ => 2 }`, "2"},
+		// NOTE: 選ばれた腕の式だけを評価する
+		{`match (1) { 1 => 1, 2 => 1 + true }`, "1"},
+		{`let f = fn(n) { match (n) { 0 => "zero", _ => f(n - 1) } }; f(3)`, "zero"},
+		{`match (3) { 1 => "one", 2 => "two" }`, "ERROR: 1:1: no match arm for INTEGER: 3"},
+		{`match ("c") {}`, "ERROR: 1:1: no match arm for STRING: c"},
+		{`match (1) { (y) => 1 }`, "ERROR: 1:14: identifier not found: y"},
+		// NOTE: 識別子は値を束縛し、`_`はどんな値にも一致する
+		{`match (5) { n => n * 2 }`, "10"},
+		{`let n = 1; match (5) { n => n }; n`, "1"},
+		{`match ([1, 2, 3]) { [first, ...rest] => rest }`, "[2, 3]"},
+		{`match ([1, 2, 3]) { [a, b] => "two", [a, b, c] => a + b + c }`, "6"},
+		{`match ([1]) { [a, b, ...rest] => "many", [a, ...rest] => rest }`, "[]"},
+		{`match ([]) { [x, ..._] => x, [] => "empty" }`, "empty"},
+		{`match ([1, [2, 3]]) { [1, [_, y]] => y }`, "3"},
+		{`match ([2, 2]) { [x, (x)] => "pair", _ => "other" }`, "pair"},
+		{`match ({"name": "Monkey", "age": 5}) { {"name": n} => n }`, "Monkey"},
+		{`match ({"age": 5}) { {"name": n} => n, {"age": a} => a }`, "5"},
+		{`match ({"user": {"tags": ["a", "b"]}}) { {"user": {"tags": [t, ..._]}} => t }`, "a"},
+		{`let k = "id"; match ({"id": 7}) { {k: 7} => "found" }`, "found"},
+		{`match (1.5) { x: INTEGER => "int", x: FLOAT => "float" }`, "float"},
+		{`match (99999999999999999999) { x: INTEGER => "int" }`, "int"},
+		{`match (len) { f: FUNCTION => "fn" }`, "fn"},
+		{`match (first([])) { _: NULL => "null" }`, "null"},
+		{`match ([1, "a"]) { [x: INTEGER, y: INTEGER] => 1, [x: INTEGER, y: STRING] => y }`, "a"},
+		{`match (-3) { n if n > 0 => "positive", n if n < 0 => "negative", _ => "zero" }`, "negative"},
+		{`match ([5, 1]) { [a, b] if a < b => "asc", [a, b] => "desc" }`, "desc"},
+		{`let f = fn(xs) { match (xs) { [] => 0, [x, ...rest] => x + f(rest) } }; f([1, 2, 3, 4])`, "10"},
+		{`match (1) { x: INT => x }`, "ERROR: 1:16: unknown type in pattern: INT"},
+		{`match ({}) { {[]: x} => x }`, "ERROR: 1:15: unusable as hash key: ARRAY"},
+		{`match (1) { n if n + true => n }`, "ERROR: 1:18: type mismatch: INTEGER + BOOLEAN"},
+		{`match ([1, 2]) { [x] => x }`, "ERROR: 1:1: no match arm for ARRAY: [1, 2]"},
+		// NOTE: `{`で始まる腕の式はブロックで、最後の式の値が腕の値になる
+		{`match (3) { n => { let m = n * 2; m + 1 } }`, "7"},
+		{`let m = 1; match (2) { n => { let m = n; m } }; m`, "1"},
+		{`let h = match (1) { _ => ({"a": 1}) }; h["a"]`, "1"},
+		{`match (1) { _ => {} }`, "null"},
+		{`let f = fn(n) { match (n) { 0 => { return "zero"; 1 }, _ => { let r = f(n - 1); r } } }; f(3)`, "zero"},
+		// NOTE: 値のパターンは`==`と同じく、整数を丸めずに比べる
+		{`match (9007199254740993) { 9007199254740992.0 => "same", _ => "different" }`, "different"},
+		{`[9007199254740993 == 9007199254740992.0, {9007199254740992.0: 1}[9007199254740993]]`, "[false, null]"},
+		// NOTE: パターンに書かれた式の中の`return`や`break`は、`match`の外に伝わる
+		{`let f = fn() { match (1) { (if (true) { return 5 }) => 0, _ => 1 } }; f()`, "5"},
+		{`while (true) { match ([1]) { [(if (true) { break; })] => 0, _ => 1 } } "done"`, "done"},
+		{`let f = fn() { match ({"a": 1}) { {(if (true) { return "key" }): x} => x } }; f()`, "key"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	tests := []struct {
+		maxCallDepth  int
+		input         string
+		expected      interface{}
+		expectedStack int
+	}{
+		{100, "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(99);", 99, 0},
+		{100, "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100000);", "maximum recursion depth exceeded", 101},
+		// NOTE: 末尾呼び出しは深さに数えない
+		{100, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100000);", 0, 0},
+		// NOTE: 指定しなければ`DefaultMaxCallDepth`で制限し、負の値を指定すれば制限しない
+		{0, "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(9999);", 9999, 0},
+		{0, "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1000000);", "maximum recursion depth exceeded", evaluator.DefaultMaxCallDepth + 1},
+		{-1, "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(20000);", 20000, 0},
+	}
+
+	for _, tt := range tests {
+		interpreter := evaluator.NewInterpreter(evaluator.Options{MaxCallDepth: tt.maxCallDepth})
+		evaluated := interpreter.Eval(testParse(tt.input), object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+
+			if errObj.Kind != object.RECURSION_LIMIT_EXCEEDED {
+				t.Errorf("wrong error kind. got=%q", errObj.Kind)
+			}
+
+			if len(errObj.Stack) != tt.expectedStack {
+				t.Errorf("wrong stack length. expected=%d, got=%d", tt.expectedStack, len(errObj.Stack))
+			}
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -585,13 +1315,116 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[5]`, "y"},
+		{`"monkey"[6]`, nil},
+		{`"monkey"[-1]`, nil},
+		{`"日本語"[1]`, "本"},
+		{`let s = "🐵🙈"; s[len(s) - 1]`, "🙈"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// NOTE: 末尾呼び出しでGoのスタックが伸びていないことを確かめるため、スタックの上限を小さくしておく
+	defer debug.SetMaxStack(debug.SetMaxStack(8 << 20))
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			"let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100000);",
+			0,
+		},
+		{
+			"let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0);",
+			5000050000,
+		},
+		{
+			`
+			let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			if (isEven(100000)) { 1 } else { 0 }
+			`,
+			1,
+		},
+		{
+			"let count = fn(n) { if (n > 0) { return count(n - 1); }; n }; count(100000);",
+			0,
+		},
+		{
+			"let loop = fn(n) { match (n) { 0 => 0, m if m > 0 => loop(m - 1) } }; loop(100000);",
+			0,
+		},
+		{
+			"let loop = fn(n) { if (n == 0) { 0 } else if (n > 0) { loop(n - 1) } }; loop(100000);",
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCallStackTrace(t *testing.T) {
+	input := `let loop = fn(n) {
+  if (n == 0) { 1 + true } else { loop(n - 1) }
+};
+loop(100000);`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned.")
+	}
+
+	expectedInspect := "ERROR: 2:17: type mismatch: INTEGER + BOOLEAN\n" +
+		"\tat loop (called at 2:35)\n" +
+		"\tat loop (called at 4:1)"
+	if errObj.Inspect() != expectedInspect {
+		t.Errorf(
+			"wrong errObj.Inspect(). expected=%q, got=%q",
+			expectedInspect,
+			errObj.Inspect(),
+		)
+	}
+}
+
 func testEval(input string) object.Object {
+	env := object.NewEnvironment()
+	return evaluator.Eval(testParse(input), env)
+}
+
+func testParse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
 
-	return evaluator.Eval(program, env)
+	return p.ParseProgram()
 }
 
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
@@ -614,6 +1447,27 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	// NOTE: 浮動小数点数の誤差を考慮して比較する
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf(
+			"object has wrong value. got=%g, want=%g",
+			result.Value,
+			expected,
+		)
+
+		return false
+	}
+
+	return true
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
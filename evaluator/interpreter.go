@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/lexer"
+	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/parser"
+	"io"
+	"os"
+	"reflect"
+)
+
+// NOTE: `Options.MaxCallDepth`を指定しない場合の上限。Goのスタックを使い切らない程度の深さにしてある
+const DefaultMaxCallDepth = 10000
+
+type Options struct {
+	Stdout io.Writer // `puts`の出力先。nilなら標準出力
+	Stderr io.Writer // 構文エラーと構文解析のトレースの出力先。nilなら標準エラー出力
+
+	// NOTE: 関数呼び出しのネストの上限。0なら`DefaultMaxCallDepth`、負の値なら制限しない。
+	// 深すぎる再帰はGoのスタックを使い切ってプロセスごと落ちるので、制限しない場合は信頼できるコードだけを評価すること
+	MaxCallDepth int
+	Limits       Limits
+	TraceParser  bool // `Run`で構文解析の過程を`Stderr`に出力する
+
+	// NOTE: `Run`で内側のスコープの束縛が外側の束縛を隠す場合に、警告を`Stderr`に出力する
+	WarnShadowing bool
+}
+
+// NOTE: 評価に必要な状態はすべてインタプリタが持つので、別々のインタプリタは並行して動かせる。
+// ただし`TRUE`、`FALSE`、`NULL`は変更されることのない値なので、すべてのインタプリタで共有している
+type Interpreter struct {
+	options  Options
+	builtins map[string]object.Object // 組み込み関数と、`Define`でGoから登録された値
+}
+
+func NewInterpreter(options Options) *Interpreter {
+	if options.Stdout == nil {
+		options.Stdout = os.Stdout
+	}
+	if options.Stderr == nil {
+		options.Stderr = os.Stderr
+	}
+	if options.MaxCallDepth == 0 {
+		options.MaxCallDepth = DefaultMaxCallDepth
+	}
+
+	return &Interpreter{
+		options:  options,
+		builtins: newBuiltins(options.Stdout),
+	}
+}
+
+// NOTE: Goの値をMonkeyのプログラムから参照できるようにする。`value`には`object.Object`、
+// `object.BuiltinFunction`と同じ形の関数、`object.WrapFunction`で包める普通の関数、
+// または`object.FromGo`で変換できる値を渡せる。
+// 評価中のインタプリタに対しては呼ばないこと
+func (i *Interpreter) Define(name string, value interface{}) error {
+	switch value := value.(type) {
+	case object.Object:
+		i.builtins[name] = value
+	case object.BuiltinFunction:
+		i.builtins[name] = &object.Builtin{Fn: value}
+	case func(args ...object.Object) object.Object:
+		i.builtins[name] = &object.Builtin{Fn: value}
+	default:
+		if reflect.ValueOf(value).Kind() != reflect.Func {
+			obj, err := object.FromGo(value)
+			if err != nil {
+				return err
+			}
+
+			i.builtins[name] = obj
+			return nil
+		}
+
+		builtin, err := object.WrapFunction(name, value)
+		if err != nil {
+			return err
+		}
+
+		i.builtins[name] = builtin
+	}
+
+	return nil
+}
+
+func (i *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	return i.EvalContext(context.Background(), node, env)
+}
+
+// NOTE: `ctx`がキャンセルされるか、`Limits`を超えた時点で評価を打ち切り、`Kind`付きのエラーを返す
+func (i *Interpreter) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	ev := &evaluation{interpreter: i, ctx: ctx, limits: i.options.Limits}
+	return ev.evaluate(node, env)
+}
+
+// NOTE: ソースコードを解析して評価する。構文エラーがあれば`Stderr`に出力し、評価せずにnilを返す
+func (i *Interpreter) Run(ctx context.Context, filename, input string, env *object.Environment) object.Object {
+	l := lexer.NewWithFilename(filename, input)
+	p := parser.New(l)
+	if i.options.TraceParser {
+		p.EnableTracing(i.options.Stderr)
+	}
+	if i.options.WarnShadowing {
+		p.WarnShadowing()
+	}
+
+	program := p.ParseProgram()
+	for _, d := range p.Diagnostics() {
+		io.WriteString(i.options.Stderr, d.Error()+"\n")
+	}
+	if len(p.Errors()) != 0 {
+		return nil
+	}
+
+	return i.EvalContext(ctx, program, env)
+}
@@ -0,0 +1,79 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/yasaichi-sandbox/monkey/object"
+)
+
+// NOTE: コンテキストの確認にはコストがかかるので、このステップ数ごとに確認する
+const contextCheckInterval = 256
+
+// NOTE: 信頼できないコードを評価するための制限。0以下の項目は制限しない
+type Limits struct {
+	MaxSteps       int // 評価するノードの数の上限
+	MaxAllocations int // 生成するオブジェクトの量の上限。配列とハッシュは要素数、文字列はバイト数も加える
+}
+
+func (ev *evaluation) allocate(obj object.Object) object.Object {
+	if err := ev.charge(allocationSize(obj)); err != nil {
+		return err
+	}
+
+	return obj
+}
+
+func (ev *evaluation) charge(size int) *object.Error {
+	if ev.limits.MaxAllocations <= 0 {
+		return nil
+	}
+
+	ev.allocations += size
+	if ev.allocations > ev.limits.MaxAllocations {
+		return newLimitError(object.ALLOCATION_LIMIT_EXCEEDED, "allocation limit exceeded")
+	}
+
+	return nil
+}
+
+func (ev *evaluation) step() *object.Error {
+	ev.steps++
+
+	if ev.limits.MaxSteps > 0 && ev.steps > ev.limits.MaxSteps {
+		return newLimitError(object.STEP_LIMIT_EXCEEDED, "step limit exceeded")
+	}
+
+	// NOTE: 既にキャンセルされている場合に何も評価しないよう、最初のステップでも確認する
+	if ev.steps%contextCheckInterval != 1 {
+		return nil
+	}
+
+	select {
+	case <-ev.ctx.Done():
+		if ev.ctx.Err() == context.DeadlineExceeded {
+			return newLimitError(object.DEADLINE_EXCEEDED, "execution deadline exceeded")
+		}
+
+		return newLimitError(object.CANCELED, "execution canceled")
+	default:
+		return nil
+	}
+}
+
+func allocationSize(obj object.Object) int {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return 1 + len(obj.Elements)
+	case *object.Hash:
+		return 1 + obj.Len()
+	case *object.String:
+		return 1 + len(obj.Value)
+	case *object.Boolean, *object.Null, *object.Error:
+		return 0 // NOTE: 真偽値とnullは使い回しているし、エラーが返れば評価は終わる
+	}
+
+	return 1
+}
+
+func newLimitError(kind object.ErrorKind, message string) *object.Error {
+	return &object.Error{Kind: kind, Message: message}
+}
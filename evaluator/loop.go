@@ -0,0 +1,25 @@
+package evaluator
+
+import (
+	"github.com/yasaichi-sandbox/monkey/object"
+)
+
+// NOTE: `break`と`continue`。`ReturnValue`と同じくブロックの評価を打ち切って、それを囲むループまで伝わる。
+// ループの外には出ないので、Monkeyのプログラムからは見えない
+type loopControl struct {
+	continues bool // NOTE: `continue`なら真、`break`なら偽
+}
+
+var (
+	breakLoop    = &loopControl{continues: false}
+	continueLoop = &loopControl{continues: true}
+)
+
+func (lc *loopControl) Inspect() string {
+	if lc.continues {
+		return "continue"
+	}
+
+	return "break"
+}
+func (*loopControl) Type() object.ObjectType { return "LOOP_CONTROL" }
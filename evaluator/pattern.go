@@ -0,0 +1,134 @@
+package evaluator
+
+import (
+	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/object"
+)
+
+// NOTE: 型のパターンに書ける型の名前。多倍長整数は`INTEGER`、組み込み関数は`FUNCTION`に一致する
+var patternTypes = map[string][]object.ObjectType{
+	"ARRAY":    {object.ARRAY_OBJ},
+	"BOOLEAN":  {object.BOOLEAN_OBJ},
+	"FLOAT":    {object.FLOAT_OBJ},
+	"FUNCTION": {object.FUNCTION_OBJ, object.BUILTIN_OBJ},
+	"HASH":     {object.HASH_OBJ},
+	"INTEGER":  {object.INTEGER_OBJ, object.BIGINT_OBJ},
+	"NULL":     {object.NULL_OBJ},
+	"STRING":   {object.STRING_OBJ},
+}
+
+// NOTE: 値が型のパターンに書かれた型を持つかどうか。VMからも使う
+func MatchType(obj object.Object, name string) (bool, *object.Error) {
+	types, ok := patternTypes[name]
+	if !ok {
+		return false, newError("unknown type in pattern: %s", name)
+	}
+
+	return hasType(obj, types), nil
+}
+
+// NOTE: 値がパターンに一致するかどうか。一致した場合、パターンが束縛する名前を`env`に登録する。
+// 一致しなかった場合も途中まで登録した名前は残るので、呼び出し側で環境ごと捨てる。
+// パターンに書かれた式の評価が打ち切られた場合は、その値（エラーや`return`など）を2つ目の戻り値で返す
+func (ev *evaluation) matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.IdentifierPattern:
+		if pattern.Type != nil {
+			matched, err := MatchType(value, pattern.Type.Value)
+			if err != nil {
+				err.Pos = pattern.Type.Pos()
+				return false, err
+			}
+
+			if !matched {
+				return false, nil
+			}
+		}
+
+		if pattern.Name.Value != "_" {
+			env.Set(pattern.Name.Value, value)
+		}
+
+		return true, nil
+	case *ast.ValuePattern:
+		expected := ev.evaluate(pattern.Value, env)
+		if isAbrupt(expected) {
+			return false, expected
+		}
+
+		return object.Equal(value, expected), nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return false, nil
+		}
+
+		n := len(pattern.Elements)
+		if len(array.Elements) < n || pattern.Rest == nil && len(array.Elements) != n {
+			return false, nil
+		}
+
+		for i, el := range pattern.Elements {
+			if matched, abrupt := ev.matchPattern(el, array.Elements[i], env); !matched || abrupt != nil {
+				return false, abrupt
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-n)
+			copy(rest, array.Elements[n:])
+
+			restArray := ev.allocate(&object.Array{Elements: rest})
+			if isAbrupt(restArray) {
+				return false, restArray
+			}
+
+			env.Set(pattern.Rest.Value, restArray)
+		}
+
+		return true, nil
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+
+		for _, pair := range pattern.Pairs {
+			key := ev.evaluate(pair.Key, env)
+			if isAbrupt(key) {
+				return false, key
+			}
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				err := newError("unusable as hash key: %s", key.Type())
+				err.Pos = pair.Key.Pos()
+				return false, err
+			}
+
+			// NOTE: パターンに書かれたキーがハッシュになければ一致しない
+			v, ok := hash.Get(hashKey)
+			if !ok {
+				return false, nil
+			}
+
+			if matched, abrupt := ev.matchPattern(pair.Value, v, env); !matched || abrupt != nil {
+				return false, abrupt
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func hasType(obj object.Object, types []object.ObjectType) bool {
+	for _, t := range types {
+		if obj.Type() == t {
+			return true
+		}
+	}
+
+	return false
+}
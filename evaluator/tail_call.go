@@ -0,0 +1,20 @@
+package evaluator
+
+import (
+	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/token"
+)
+
+// NOTE: スタックトレースに残す末尾呼び出しの最大数
+const maxTailFrames = 100
+
+// NOTE: 末尾位置にある関数呼び出し。その場では呼び出さずに、呼び出し元の`applyFunction`まで戻ってから実行する。
+// `applyFunction`の外には出ないので、Monkeyのプログラムからは見えない
+type tailCall struct {
+	fn       *object.Function
+	args     []object.Object
+	callSite token.Position
+}
+
+func (*tailCall) Inspect() string         { return "tail call" }
+func (*tailCall) Type() object.ObjectType { return "TAIL_CALL" }
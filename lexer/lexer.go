@@ -1,42 +1,103 @@
 package lexer
 
 import (
+	"fmt"
 	"github.com/yasaichi-sandbox/monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+type Error struct {
+	Pos     token.Position
+	End     token.Position
+	Message string
+}
+
 type Lexer struct {
 	input        string
-	position     int  // 入力における現在の位置（現在の文字を指し示す）
+	filename     string
+	emitComments bool // コメントを`token.COMMENT`として返すかどうか
+	errors       []Error
+	position     int  // 入力における現在の位置（現在の文字の先頭のバイトを指し示す）
 	readPosition int  // これから読み込む位置（現在の文字の次）
-	ch           byte // 現在検査中の文字
+	ch           rune // 現在検査中の文字（UTF-8として解釈したもの）
+	line         int  // 現在の文字がある行（1始まり）
+	column       int  // 現在の文字がある列（1始まり、文字単位で数える）
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+func NewWithFilename(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 
 	return l
 }
 
+// NOTE: フォーマッタなどのようにコメントを残したい場合に使う
+func (l *Lexer) EmitComments(emit bool) {
+	l.emitComments = emit
+}
+
+// NOTE: ILLEGALトークンを返したときに、その理由がここに記録される
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
 // NOTE: 字句解析時にはこのメソッドを繰り返し呼んで行う。イテレータっぽい使われ方。
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhitespace()
+
+		pos := l.currentPosition()
+		tok := l.nextToken()
+		tok.Pos = pos
+		tok.End = l.currentPosition()
+
+		if tok.Type == token.COMMENT && !l.emitComments {
+			continue
+		}
 
-	l.skipWhitespace()
+		return tok
+	}
+}
+
+func (l *Lexer) nextToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
-		if l.peekChar() == '=' {
+		switch l.peekChar() {
+		case '=':
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: "=="}
+		case '>':
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
+		default:
+			tok = newToken(token.ASSIGN, l.ch)
+		}
+	case '+':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
 
 			break
 		}
 
-		tok = newToken(token.ASSIGN, l.ch)
-	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+
+			break
+		}
+
 		tok = newToken(token.MINUS, l.ch)
 	case '!':
 		if l.peekChar() == '=' {
@@ -48,15 +109,45 @@ func (l *Lexer) NextToken() token.Token {
 
 		tok = newToken(token.BANG, l.ch)
 	case '*':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+
+			break
+		}
+
 		tok = newToken(token.ASTERISK, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		switch l.peekChar() {
+		case '/':
+			return token.Token{Type: token.COMMENT, Literal: l.readLineComment()}
+		case '*':
+			return l.readBlockComment()
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		default:
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
 		tok = newToken(token.GT, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		// NOTE: `.`だけ、あるいは`..`は不正なトークンにする
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+
+			break
+		}
+
+		tok = newToken(token.ILLEGAL, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case ';':
@@ -76,7 +167,9 @@ func (l *Lexer) NextToken() token.Token {
 	case 0:
 		tok = token.Token{Type: token.EOF, Literal: ""}
 	case '"':
-		tok = token.Token{Type: token.STRING, Literal: l.readString()}
+		tok = l.readString()
+	case '`':
+		tok = l.readRawString()
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
@@ -84,54 +177,173 @@ func (l *Lexer) NextToken() token.Token {
 
 			return tok
 		} else if isDigit(l.ch) {
-			return token.Token{Type: token.INT, Literal: l.readNumber()}
+			return l.readNumber()
+		}
+
+		// NOTE: 不正なUTF-8のバイト列は元のバイト列をそのままリテラルにする。U+FFFDそのものが
+		// 書かれている場合は3バイトとして読まれるので区別できる
+		if l.ch == utf8.RuneError && l.readPosition-l.position == 1 {
+			l.addError(l.currentPosition(), "invalid UTF-8 encoding")
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
+
+			break
 		}
 
-		tok = token.Token{Type: token.ILLEGAL, Literal: ""}
+		tok = newToken(token.ILLEGAL, l.ch)
 	}
 
 	l.readChar()
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
 
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
 }
 
 func (l *Lexer) readChar() {
+	// NOTE: 一度終端に達したら位置情報が入力の外に進んでいかないようにする
+	if l.readPosition > len(l.input) {
+		return
+	}
+
+	// NOTE: 改行文字の次の文字から新しい行が始まる
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	// NOTE: 終端に達した後に`readChar`を読んでも常にNUL文字を返したいならこういう実装になる
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // NOTE: ASCIIのNUL文字（NUL終端文字列における文字列の終端）に対応。
 	} else {
-		l.ch = l.input[l.readPosition]
+		// NOTE: マルチバイト文字の場合は1文字で複数バイト進む。不正なバイト列の場合は
+		// `utf8.RuneError`が返り、1バイトだけ進む
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
+}
+
+// NOTE: エラーの範囲は`pos`から現在検査中の文字の直後まで
+func (l *Lexer) addError(pos token.Position, format string, a ...interface{}) {
+	end := l.currentPosition()
+	if l.ch != 0 {
+		end.Offset = l.readPosition
+		end.Column++
+	}
+
+	l.errors = append(l.errors, Error{
+		Pos:     pos,
+		End:     end,
+		Message: fmt.Sprintf(format, a...),
+	})
 }
 
-func (l *Lexer) readNumber() string {
+// /* keyakizaka46 */
+// └ l.ch
+func (l *Lexer) readBlockComment() token.Token {
+	pos := l.currentPosition()
 	position := l.position
 
-	for isDigit(l.ch) {
+	l.readChar()
+	l.readChar() // NOTE: この時点で`l.ch`は`/*`の直後の文字
+
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			l.addError(pos, "unterminated block comment")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[position:l.position]}
+		}
+
+		l.readChar()
+	}
+
+	l.readChar()
+	l.readChar() // NOTE: `*/`の直後まで進める
+
+	return token.Token{Type: token.COMMENT, Literal: l.input[position:l.position]}
+}
+
+// // keyakizaka46
+// └ l.ch
+func (l *Lexer) readLineComment() string {
+	position := l.position
+
+	// NOTE: 改行文字はコメントに含めない
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
+// 46, 3.14, 1e-9
+// └ l.ch
+func (l *Lexer) readNumber() token.Token {
+	pos := l.currentPosition()
+	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+
+	// NOTE: `1.`のように小数点の後に数字が続かない場合は小数として扱わない
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		tokenType = token.FLOAT
+		l.readChar()
+
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+
+		if !isDigit(l.ch) {
+			l.addError(pos, "exponent has no digits")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[position:l.position]}
+		}
+
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return token.Token{Type: tokenType, Literal: l.input[position:l.position]}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 
-	for isLetter(l.ch) {
+	// NOTE: Goと同じく、2文字目以降には数字も使える
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 
@@ -139,19 +351,115 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// NOTE: 読み終えたとき`l.ch`は閉じ側の`"`を指している
+//
+// "keyakizaka\t46"
+// └ l.ch
+func (l *Lexer) readString() token.Token {
+	pos := l.currentPosition()
+	position := l.position
+	malformed := false
+
+	var out strings.Builder
 
 	for {
 		l.readChar()
 
+		switch l.ch {
 		// NOTE: 最初書いたときにNULL文字についての考慮を忘れていた
-		if l.ch == '"' || l.ch == 0 {
-			break
+		case 0:
+			l.addError(pos, "unterminated string")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[position:l.position]}
+		case '"':
+			// NOTE: 不正なエスケープシーケンスがあっても、閉じ側の`"`までは読み進めておく
+			if malformed {
+				return token.Token{Type: token.ILLEGAL, Literal: l.input[position : l.position+1]}
+			}
+
+			return token.Token{Type: token.STRING, Literal: out.String()}
+		case '\\':
+			if !l.readEscape(&out) {
+				malformed = true
+			}
+		default:
+			out.WriteRune(l.ch)
 		}
 	}
+}
 
-	return l.input[position:l.position]
+// NOTE: 読み始めるとき`l.ch`は`\`を指していて、読み終えたときはエスケープシーケンスの末尾を指す
+func (l *Lexer) readEscape(out *strings.Builder) bool {
+	pos := l.currentPosition()
+	l.readChar()
+
+	switch l.ch {
+	case 0:
+		// NOTE: 文字列が閉じられていないことは呼び出し側で報告する
+		return true
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		if l.peekChar() != '{' {
+			l.addError(pos, "invalid unicode escape: missing '{'")
+			return false
+		}
+		l.readChar()
+
+		start := l.readPosition
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+		}
+		digits := l.input[start:l.readPosition]
+
+		if l.peekChar() != '}' || len(digits) == 0 || len(digits) > 6 {
+			l.addError(pos, "invalid unicode escape: \\u{%s", digits)
+			return false
+		}
+		l.readChar()
+
+		// NOTE: 6桁以下の16進数なのでエラーにはならない
+		code, _ := strconv.ParseUint(digits, 16, 32)
+		if !utf8.ValidRune(rune(code)) {
+			l.addError(pos, "invalid unicode code point: \\u{%s}", digits)
+			return false
+		}
+
+		out.WriteRune(rune(code))
+	default:
+		l.addError(pos, "unknown escape sequence: \\%c", l.ch)
+		return false
+	}
+
+	return true
+}
+
+// NOTE: エスケープシーケンスを解釈せず、改行もそのまま含める
+//
+// `keyakizaka46`
+// └ l.ch
+func (l *Lexer) readRawString() token.Token {
+	pos := l.currentPosition()
+	position := l.position
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case 0:
+			l.addError(pos, "unterminated raw string")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[position:l.position]}
+		case '`':
+			return token.Token{Type: token.STRING, Literal: l.input[position+1 : l.position]}
+		}
+	}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -160,13 +468,20 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-// NOTE: そもそもなぜbyte(uint8)とrune(int32)が比較できるのかがわからなかった、、、
-func isLetter(ch byte) bool {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) ||
+		'a' <= ch && ch <= 'f' ||
+		'A' <= ch && ch <= 'F'
+}
+
+// NOTE: Goの識別子と同じく、Unicodeの文字（カテゴリL）と`_`を識別子に使える
+func isLetter(ch rune) bool {
 	return 'a' <= ch && ch <= 'z' ||
 		'A' <= ch && ch <= 'Z' ||
-		ch == '_'
+		ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
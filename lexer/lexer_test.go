@@ -15,7 +15,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -30,6 +30,12 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 { "foo": "bar" }
+10 % 3;
+while (x) { break; }
+for (c in s) { continue; }
+x = 1; x += 2; x -= 3; x *= 4; x /= 5;
+const y = 6;
+match (y) { [a, ...b] => 1 }
 `
 	tests := []struct {
 		expectedType    token.TokenType
@@ -121,6 +127,67 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.INT, "10"},
+		{token.PERCENT, "%"},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.BREAK, "break"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "c"},
+		{token.IN, "in"},
+		{token.IDENT, "s"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.CONTINUE, "continue"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.CONST, "const"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.INT, "6"},
+		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 
@@ -148,3 +215,325 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// header
+let x = 5; // trailing
+/* block
+   comment */ x / 2;
+/* unterminated`
+
+	tests := []struct {
+		emitComments bool
+		expected     []token.Token
+	}{
+		{
+			false,
+			[]token.Token{
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "5"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.ILLEGAL, Literal: "/* unterminated"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			true,
+			[]token.Token{
+				{Type: token.COMMENT, Literal: "// header"},
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "5"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.COMMENT, Literal: "// trailing"},
+				{Type: token.COMMENT, Literal: "/* block\n   comment */"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.ILLEGAL, Literal: "/* unterminated"},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(input)
+		l.EmitComments(tt.emitComments)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf(
+					"emitComments=%t, tests[%d] - token wrong. expected=%s(%q), got=%s(%q)",
+					tt.emitComments,
+					i,
+					expected.Type,
+					expected.Literal,
+					tok.Type,
+					tok.Literal,
+				)
+			}
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("lexer has wrong number of errors. got=%d", len(errors))
+		}
+		if errors[0].Message != "unterminated block comment" {
+			t.Errorf("wrong error message. got=%q", errors[0].Message)
+		}
+		if errors[0].Pos.String() != "5:1" {
+			t.Errorf("wrong error position. got=%q", errors[0].Pos)
+		}
+	}
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"46", token.INT, "46"},
+		{"3.14", token.FLOAT, "3.14"},
+		{"0.5", token.FLOAT, "0.5"},
+		{"1e-9", token.FLOAT, "1e-9"},
+		{"2.5E+3", token.FLOAT, "2.5E+3"},
+		{"1e", token.ILLEGAL, "1e"},
+		{"1e+", token.ILLEGAL, "1e+"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf(
+				"tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i,
+				tt.expectedType,
+				tok.Type,
+			)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf(
+				"tests[%d] - literal wrong. expected=%q, got=%q",
+				i,
+				tt.expectedLiteral,
+				tok.Literal,
+			)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - input not fully consumed. got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestNextTokenPosition(t *testing.T) {
+	input := `let five = 5;
+if (five) {
+	"foo"
+}`
+
+	pos := func(offset, line, column int) token.Position {
+		return token.Position{
+			Filename: "test.mk",
+			Offset:   offset,
+			Line:     line,
+			Column:   column,
+		}
+	}
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedPos    token.Position
+		expectedEndPos token.Position
+	}{
+		{token.LET, pos(0, 1, 1), pos(3, 1, 4)},
+		{token.IDENT, pos(4, 1, 5), pos(8, 1, 9)},
+		{token.ASSIGN, pos(9, 1, 10), pos(10, 1, 11)},
+		{token.INT, pos(11, 1, 12), pos(12, 1, 13)},
+		{token.SEMICOLON, pos(12, 1, 13), pos(13, 1, 14)},
+		{token.IF, pos(14, 2, 1), pos(16, 2, 3)},
+		{token.LPAREN, pos(17, 2, 4), pos(18, 2, 5)},
+		{token.IDENT, pos(18, 2, 5), pos(22, 2, 9)},
+		{token.RPAREN, pos(22, 2, 9), pos(23, 2, 10)},
+		{token.LBRACE, pos(24, 2, 11), pos(25, 2, 12)},
+		{token.STRING, pos(27, 3, 2), pos(32, 3, 7)},
+		{token.RBRACE, pos(33, 4, 1), pos(34, 4, 2)},
+		{token.EOF, pos(34, 4, 2), pos(34, 4, 2)},
+		{token.EOF, pos(34, 4, 2), pos(34, 4, 2)},
+	}
+
+	l := lexer.NewWithFilename("test.mk", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf(
+				"tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i,
+				tt.expectedType,
+				tok.Type,
+			)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf(
+				"tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i,
+				tt.expectedPos,
+				tok.Pos,
+			)
+		}
+
+		if tok.End != tt.expectedEndPos {
+			t.Fatalf(
+				"tests[%d] - end wrong. expected=%+v, got=%+v",
+				i,
+				tt.expectedEndPos,
+				tok.End,
+			)
+		}
+	}
+}
+
+func TestNextTokenStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{`"foo\nbar"`, token.STRING, "foo\nbar", ""},
+		{`"foo\tbar\r"`, token.STRING, "foo\tbar\r", ""},
+		{`"say \"hi\""`, token.STRING, `say "hi"`, ""},
+		{`"C:\\monkey"`, token.STRING, `C:\monkey`, ""},
+		{`"\u{48}\u{1F435}"`, token.STRING, "H\U0001F435", ""},
+		{"`raw\n\\n \"string\"`", token.STRING, "raw\n\\n \"string\"", ""},
+		{`"foo`, token.ILLEGAL, `"foo`, "unterminated string"},
+		{"`foo", token.ILLEGAL, "`foo", "unterminated raw string"},
+		{`"foo\qbar"`, token.ILLEGAL, `"foo\qbar"`, "unknown escape sequence: \\q"},
+		{`"\u0048"`, token.ILLEGAL, `"\u0048"`, "invalid unicode escape: missing '{'"},
+		{`"\u{zz}"`, token.ILLEGAL, `"\u{zz}"`, "invalid unicode escape: \\u{"},
+		{`"\u{110000}"`, token.ILLEGAL, `"\u{110000}"`, "invalid unicode code point: \\u{110000}"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf(
+				"tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i,
+				tt.expectedType,
+				tok.Type,
+			)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf(
+				"tests[%d] - literal wrong. expected=%q, got=%q",
+				i,
+				tt.expectedLiteral,
+				tok.Literal,
+			)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - input not fully consumed. got=%q", i, next.Type)
+		}
+
+		errors := l.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("tests[%d] - unexpected errors: %+v", i, errors)
+			}
+			continue
+		}
+
+		if len(errors) != 1 {
+			t.Fatalf("tests[%d] - lexer has wrong number of errors. got=%d", i, len(errors))
+		}
+		if errors[0].Message != tt.expectedError {
+			t.Errorf(
+				"tests[%d] - error message wrong. expected=%q, got=%q",
+				i,
+				tt.expectedError,
+				errors[0].Message,
+			)
+		}
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := "let 名前 = \"モンキー🐵\"; x1 + _ü; é9 \xff"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "名前", 5},
+		{token.ASSIGN, "=", 8},
+		{token.STRING, "モンキー🐵", 10},
+		{token.SEMICOLON, ";", 17},
+		{token.IDENT, "x1", 19},
+		{token.PLUS, "+", 22},
+		{token.IDENT, "_ü", 24},
+		{token.SEMICOLON, ";", 26},
+		{token.IDENT, "é9", 28},
+		{token.ILLEGAL, "\xff", 31},
+		{token.EOF, "", 32},
+	}
+
+	l := lexer.New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf(
+				"tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i,
+				tt.expectedType,
+				tok.Type,
+			)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf(
+				"tests[%d] - literal wrong. expected=%q, got=%q",
+				i,
+				tt.expectedLiteral,
+				tok.Literal,
+			)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf(
+				"tests[%d] - column wrong. expected=%d, got=%d",
+				i,
+				tt.expectedColumn,
+				tok.Pos.Column,
+			)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Message != "invalid UTF-8 encoding" {
+		t.Errorf("wrong lexer errors. got=%+v", errors)
+	}
+}
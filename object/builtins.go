@@ -0,0 +1,290 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+)
+
+type BuiltinDefinition struct {
+	Name    string
+	Builtin *Builtin
+}
+
+// NOTE: `puts`の出力先ごとに組み込み関数の一覧を作る。評価器とVMの両方で使うので、
+// 定義順（=コンパイラが使うインデックス）が変わらないようにスライスで返す
+func NewBuiltins(out io.Writer) []BuiltinDefinition {
+	return []BuiltinDefinition{
+		{
+			"first",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					if args[0].Type() != ARRAY_OBJ {
+						return newError(
+							"argument to `first` must be ARRAY, got %s",
+							args[0].Type(),
+						)
+					}
+
+					array := args[0].(*Array)
+					if len(array.Elements) == 0 {
+						return nil
+					}
+
+					return array.Elements[0]
+				},
+			},
+		},
+		{
+			"float",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					switch arg := args[0].(type) {
+					case *Integer:
+						return &Float{Value: float64(arg.Value)}
+					case *BigInt:
+						value, _ := new(big.Float).SetInt(arg.Value).Float64()
+						return &Float{Value: value}
+					case *Float:
+						return arg
+					case *String:
+						value, err := strconv.ParseFloat(arg.Value, 64)
+						if err != nil {
+							return newError("could not convert %q to FLOAT", arg.Value)
+						}
+
+						return &Float{Value: value}
+					}
+
+					return newError(
+						"argument to `float` not supported, got %s",
+						args[0].Type(),
+					)
+				},
+			},
+		},
+		{
+			"int",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					switch arg := args[0].(type) {
+					case *Integer, *BigInt:
+						return arg
+					case *Float:
+						// NOTE: 小数点以下は0の方向に切り捨てる。NaNや無限大は整数にできない
+						if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+							return newError("could not convert %s to INTEGER", arg.Inspect())
+						}
+
+						value, _ := big.NewFloat(arg.Value).Int(nil)
+						return NewInteger(value)
+					case *String:
+						value, ok := new(big.Int).SetString(arg.Value, 10)
+						if !ok {
+							return newError("could not convert %q to INTEGER", arg.Value)
+						}
+
+						return NewInteger(value)
+					}
+
+					return newError(
+						"argument to `int` not supported, got %s",
+						args[0].Type(),
+					)
+				},
+			},
+		},
+		{
+			"json_decode",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					if args[0].Type() != STRING_OBJ {
+						return newError(
+							"argument to `json_decode` must be STRING, got %s",
+							args[0].Type(),
+						)
+					}
+
+					obj, err := DecodeJSON(args[0].(*String).Value)
+					if err != nil {
+						return newError("could not decode JSON: %s", err)
+					}
+
+					return obj
+				},
+			},
+		},
+		{
+			"json_encode",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 && len(args) != 2 {
+						return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+					}
+
+					// NOTE: 第2引数に`true`を渡すと、インデントを付けてキーを昇順に並べて出力する
+					pretty := false
+					if len(args) == 2 {
+						b, ok := args[1].(*Boolean)
+						if !ok {
+							return newError(
+								"second argument to `json_encode` must be BOOLEAN, got %s",
+								args[1].Type(),
+							)
+						}
+
+						pretty = b.Value
+					}
+
+					s, err := EncodeJSON(args[0], pretty)
+					if err != nil {
+						return newError("%s", err)
+					}
+
+					return &String{Value: s}
+				},
+			},
+		},
+		{
+			"last",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					if args[0].Type() != ARRAY_OBJ {
+						return newError(
+							"argument to `last` must be ARRAY, got %s",
+							args[0].Type(),
+						)
+					}
+
+					array := args[0].(*Array)
+					length := len(array.Elements)
+					if length == 0 {
+						return nil
+					}
+
+					return array.Elements[length-1]
+				},
+			},
+		},
+		{
+			"len",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					// NOTE: これ、nilが渡ってきたときにどうするんだ、、
+					switch arg := args[0].(type) {
+					case *Array:
+						return &Integer{Value: int64(len(arg.Elements))}
+					case *String:
+						// NOTE: バイト数ではなく文字（rune）数を返す
+						return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+					}
+
+					return newError(
+						"argument to `len` not supported, got %s",
+						args[0].Type(),
+					)
+				},
+			},
+		},
+		{
+			"push",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 2 {
+						return newError("wrong number of arguments. got=%d, want=2", len(args))
+					}
+
+					// NOTE: 第2引数はどんなオブジェクトでも良いのでチェックの必要はない
+					if args[0].Type() != ARRAY_OBJ {
+						return newError(
+							"argument to `push` must be ARRAY, got %s",
+							args[0].Type(),
+						)
+					}
+
+					array := args[0].(*Array)
+					length := len(array.Elements)
+
+					newElements := make([]Object, length+1)
+					copy(newElements, array.Elements)
+					newElements[length] = args[1]
+
+					return &Array{Elements: newElements}
+				},
+			},
+		},
+		{
+			"puts",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					for _, arg := range args {
+						fmt.Fprintln(out, arg.Inspect())
+					}
+
+					return nil
+				},
+			},
+		},
+		{
+			"rest",
+			&Builtin{
+				Fn: func(args ...Object) Object {
+					if len(args) != 1 {
+						return newError("wrong number of arguments. got=%d, want=1", len(args))
+					}
+
+					if args[0].Type() != ARRAY_OBJ {
+						return newError(
+							"argument to `rest` must be ARRAY, got %s",
+							args[0].Type(),
+						)
+					}
+
+					array := args[0].(*Array)
+					length := len(array.Elements)
+					if length == 0 {
+						return nil
+					}
+
+					// 第2引数がlength, 第3引数がcapacity。capを省略するとlenと同じ値が設定される
+					newElements := make([]Object, length-1)
+					// NOTE: この場合ポインタの配列なので、`copy`でdeep copyする必要があるのか謎だった
+					copy(newElements, array.Elements[1:])
+
+					return &Array{Elements: newElements}
+				},
+			},
+		},
+	}
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,519 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// NOTE: 変換している途中の値。ポインタ、マップ、スライスは自分自身を含むことがあるので、
+// 同じ値に戻ってきたら無限に再帰せずにエラーにする
+type visit struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// NOTE: Goの値をMonkeyのオブジェクトに変換する。スライスと配列は`Array`、マップと構造体は`Hash`になり、
+// nil（nilのポインタ、スライス、マップを含む）は`NULL`になる。構造体のキーは`monkey`タグで変えられる
+func FromGo(value interface{}) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+
+	return fromGoValue(reflect.ValueOf(value))
+}
+
+// NOTE: Monkeyのオブジェクトを素のGoの値に変換する。整数は`int64`、配列は`[]interface{}`になる。
+// ハッシュはキーがすべて文字列なら`map[string]interface{}`、そうでなければ`map[interface{}]interface{}`になる
+func ToGo(obj Object) (interface{}, error) {
+	return toGo(obj, visitedObjects{})
+}
+
+// NOTE: Monkeyのオブジェクトを`target`が指す変数の型に合わせて変換して代入する。
+// ハッシュを構造体に代入する場合、`FromGo`と同じ規則でフィールドに対応するキーを探す
+func ToGoValue(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+
+	return assignObject(obj, v.Elem(), visitedObjects{})
+}
+
+func assignObject(obj Object, v reflect.Value, visited visitedObjects) error {
+	t := v.Type()
+
+	// NOTE: `interface{}`で受け取る場合はオブジェクトそのものではなく、`ToGo`で変換した値を渡す
+	if obj != nil && t.Implements(objectType) && reflect.TypeOf(obj).AssignableTo(t) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	if _, ok := obj.(*Null); ok || obj == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+
+		return fmt.Errorf("cannot convert NULL to %s", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(t.Elem())
+		if err := assignObject(obj, p.Elem(), visited); err != nil {
+			return err
+		}
+
+		v.Set(p)
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return cannotConvert(obj, t)
+		}
+
+		value, err := toGo(obj, visited)
+		if err != nil {
+			return err
+		}
+
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			if _, ok := obj.(*BigInt); ok {
+				return outOfRange(obj, t)
+			}
+
+			return cannotConvert(obj, t)
+		}
+
+		if v.OverflowInt(i.Value) {
+			return outOfRange(obj, t)
+		}
+
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u *big.Int
+		switch obj := obj.(type) {
+		case *Integer:
+			u = big.NewInt(obj.Value)
+		case *BigInt:
+			u = obj.Value
+		default:
+			return cannotConvert(obj, t)
+		}
+
+		if !u.IsUint64() || v.OverflowUint(u.Uint64()) {
+			return outOfRange(obj, t)
+		}
+
+		v.SetUint(u.Uint64())
+	case reflect.Float32, reflect.Float64:
+		// NOTE: Monkeyの演算と同じく、整数は小数に変換して受け取る
+		switch obj := obj.(type) {
+		case *Integer:
+			v.SetFloat(float64(obj.Value))
+		case *BigInt:
+			f, _ := new(big.Float).SetInt(obj.Value).Float64()
+			v.SetFloat(f)
+		case *Float:
+			v.SetFloat(obj.Value)
+		default:
+			return cannotConvert(obj, t)
+		}
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+
+		v.SetString(s.Value)
+	case reflect.Slice, reflect.Array:
+		array, ok := obj.(*Array)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+
+		if !visited.enter(array) {
+			return cyclic(array)
+		}
+		defer visited.leave(array)
+
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(array.Elements), len(array.Elements)))
+		} else if v.Len() != len(array.Elements) {
+			return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(array.Elements), t)
+		}
+
+		for i, el := range array.Elements {
+			if err := assignObject(el, v.Index(i), visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+
+		if !visited.enter(hash) {
+			return cyclic(hash)
+		}
+		defer visited.leave(hash)
+
+		m := reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Pairs() {
+			key := reflect.New(t.Key()).Elem()
+			if err := assignObject(pair.Key, key, visited); err != nil {
+				return err
+			}
+
+			value := reflect.New(t.Elem()).Elem()
+			if err := assignObject(pair.Value, value, visited); err != nil {
+				return err
+			}
+
+			m.SetMapIndex(key, value)
+		}
+
+		v.Set(m)
+	case reflect.Struct:
+		if t == bigIntType {
+			switch obj := obj.(type) {
+			case *Integer:
+				v.Set(reflect.ValueOf(*big.NewInt(obj.Value)))
+				return nil
+			case *BigInt:
+				v.Set(reflect.ValueOf(*new(big.Int).Set(obj.Value)))
+				return nil
+			}
+
+			return cannotConvert(obj, t)
+		}
+
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+
+		if !visited.enter(hash) {
+			return cyclic(hash)
+		}
+		defer visited.leave(hash)
+
+		for i := 0; i < t.NumField(); i++ {
+			name, _, ok := fieldKey(t.Field(i))
+			if !ok {
+				continue
+			}
+
+			value, ok := hash.Get(&String{Value: name})
+			if !ok {
+				continue
+			}
+
+			if err := assignObject(value, v.Field(i), visited); err != nil {
+				return err
+			}
+		}
+	default:
+		return cannotConvert(obj, t)
+	}
+
+	return nil
+}
+
+func cannotConvert(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+// NOTE: 自分自身を含む配列やハッシュは、Goの値にすると無限に続くので変換しない
+func cyclic(obj Object) error {
+	return fmt.Errorf("cannot convert cyclic %s to a Go value", obj.Type())
+}
+
+// NOTE: 構造体のフィールドに対応するハッシュのキー。`monkey:"-"`のフィールドと非公開のフィールドは対象外
+func fieldKey(f reflect.StructField) (name string, omitEmpty bool, ok bool) {
+	if f.PkgPath != "" {
+		return "", false, false
+	}
+
+	tag := f.Tag.Get("monkey")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	name = f.Name
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+
+	return name, omitEmpty, true
+}
+
+func fromGoValue(v reflect.Value) (Object, error) {
+	return convertGoValue(v, map[visit]bool{})
+}
+
+func convertGoValue(v reflect.Value, visiting map[visit]bool) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	if v.Type().Implements(objectType) {
+		if isNil(v) {
+			return NULL, nil
+		}
+
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return NULL, nil
+		}
+
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if visiting[key] {
+			return nil, fmt.Errorf("cannot convert cyclic %s to a Monkey object", v.Type())
+		}
+
+		// NOTE: 同じ値を別々の場所から参照するのは構わないので、たどり終えたら忘れる
+		visiting[key] = true
+		defer delete(visiting, key)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+
+		return convertGoValue(v.Elem(), visiting)
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewInteger(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			el, err := convertGoValue(v.Index(i), visiting)
+			if err != nil {
+				return nil, err
+			}
+
+			elements[i] = el
+		}
+
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+
+		pairs := make([]HashPair, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := convertGoValue(iter.Key(), visiting)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := key.(Hashable); !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", v.Type().Key())
+			}
+
+			value, err := convertGoValue(iter.Value(), visiting)
+			if err != nil {
+				return nil, err
+			}
+
+			pairs = append(pairs, HashPair{Key: key, Value: value})
+		}
+
+		// NOTE: Goのマップは順序が定まらないので、変換するたびに並び順が変わらないようにキーで並べる
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+		})
+
+		hash := &Hash{}
+		for _, pair := range pairs {
+			hash.Set(pair.Key.(Hashable), pair.Value)
+		}
+
+		return hash, nil
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			i := v.Interface().(big.Int)
+			return NewInteger(new(big.Int).Set(&i)), nil
+		}
+
+		return structToHash(v, visiting)
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a Monkey object", v.Type())
+}
+
+func hashToGo(hash *Hash, visited visitedObjects) (interface{}, error) {
+	stringKeys := true
+	for _, pair := range hash.Pairs() {
+		if _, ok := pair.Key.(*String); !ok {
+			stringKeys = false
+			break
+		}
+	}
+
+	if stringKeys {
+		m := make(map[string]interface{}, hash.Len())
+		for _, pair := range hash.Pairs() {
+			value, err := toGo(pair.Value, visited)
+			if err != nil {
+				return nil, err
+			}
+
+			m[pair.Key.(*String).Value] = value
+		}
+
+		return m, nil
+	}
+
+	m := make(map[interface{}]interface{}, hash.Len())
+	for _, pair := range hash.Pairs() {
+		key, err := toGo(pair.Key, visited)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := toGo(pair.Value, visited)
+		if err != nil {
+			return nil, err
+		}
+
+		m[key] = value
+	}
+
+	return m, nil
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+func outOfRange(obj Object, t reflect.Type) error {
+	return fmt.Errorf("%s is out of range for %s", obj.Inspect(), t)
+}
+
+func structToHash(v reflect.Value, visiting map[visit]bool) (Object, error) {
+	t := v.Type()
+	hash := &Hash{}
+
+	for i := 0; i < t.NumField(); i++ {
+		name, omitEmpty, ok := fieldKey(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		if omitEmpty && field.IsZero() {
+			continue
+		}
+
+		value, err := convertGoValue(field, visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Set(&String{Value: name}, value)
+	}
+
+	return hash, nil
+}
+
+// NOTE: 配列とハッシュは自分自身を含むことがあるので、変換している途中の値に戻ってきたらエラーにする
+func toGo(obj Object, visited visitedObjects) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *BigInt:
+		return new(big.Int).Set(obj.Value), nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		if !visited.enter(obj) {
+			return nil, cyclic(obj)
+		}
+		defer visited.leave(obj)
+
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := toGo(el, visited)
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = value
+		}
+
+		return values, nil
+	case *Hash:
+		if !visited.enter(obj) {
+			return nil, cyclic(obj)
+		}
+		defer visited.leave(obj)
+
+		return hashToGo(obj, visited)
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+}
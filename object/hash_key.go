@@ -0,0 +1,76 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+// NOTE: ハッシュのキーや`match`のパターンとして等しいかどうか。ハッシュキーと同じく`1`と`1.0`は
+// 等しいものとして扱う。配列やハッシュは中身を比べず、同じオブジェクトかどうかで判断する
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Integer, *BigInt, *Float:
+		return numbersEqual(a, b)
+	}
+
+	// NOTE: 組み込みの型以外は同じオブジェクトかどうかで判断する
+	return a == b
+}
+
+func numbersEqual(a, b Object) bool {
+	if a, ok := a.(*Integer); ok {
+		if b, ok := b.(*Integer); ok {
+			return a.Value == b.Value
+		}
+	}
+
+	// NOTE: NaNはどの値とも等しくないが、同じNaNを何度もキーにできてしまうのは困るので、NaN同士は等しいことにする
+	if a, ok := a.(*Float); ok {
+		if b, ok := b.(*Float); ok {
+			return a.Value == b.Value || math.IsNaN(a.Value) && math.IsNaN(b.Value)
+		}
+	}
+
+	cmp, ok := CompareNumbers(a, b)
+	return ok && cmp == 0
+}
+
+// NOTE: 数値を丸めずに比べる。整数を`float64`に変換すると2^53を超える値は丸められるので、`big.Float`で比べる。
+// NaNはどの値とも比べられないので、2つ目の戻り値がfalseになる。評価器の比較演算子でも使う
+func CompareNumbers(a, b Object) (int, bool) {
+	x, ok := toBigFloat(a)
+	if !ok {
+		return 0, false
+	}
+
+	y, ok := toBigFloat(b)
+	if !ok {
+		return 0, false
+	}
+
+	return x.Cmp(y), true
+}
+
+// NOTE: NaNは`big.Float`で表せないので、変換できないものとして扱う
+func toBigFloat(obj Object) (*big.Float, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return new(big.Float).SetInt64(obj.Value), true
+	case *BigInt:
+		return new(big.Float).SetInt(obj.Value), true
+	case *Float:
+		if math.IsNaN(obj.Value) {
+			return nil, false
+		}
+
+		return new(big.Float).SetFloat64(obj.Value), true
+	}
+
+	return nil, false
+}
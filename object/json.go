@@ -0,0 +1,214 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NOTE: オブジェクトをJSONに変換する。ハッシュのキーは文字列に限り、挿入された順に出力する。
+// `pretty`の場合はインデントを付け、差分を取りやすいようにキーを昇順に並べる
+func EncodeJSON(obj Object, pretty bool) (string, error) {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, obj, pretty, visitedObjects{}); err != nil {
+		return "", err
+	}
+
+	if !pretty {
+		return buf.String(), nil
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+		return "", err
+	}
+
+	return indented.String(), nil
+}
+
+// NOTE: JSONをオブジェクトに変換する。小数点や指数を含まない数値は（必要なら多倍長の）整数、それ以外は小数になる
+func DecodeJSON(s string) (Object, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	obj, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+
+	return obj, nil
+}
+
+func decodeJSON(dec *json.Decoder) (Object, error) {
+	token, err := dec.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("unexpected end of JSON input")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		if token {
+			return TRUE, nil
+		}
+
+		return FALSE, nil
+	case json.Number:
+		if !strings.ContainsAny(string(token), ".eE") {
+			if value, ok := new(big.Int).SetString(string(token), 10); ok {
+				return NewInteger(value), nil
+			}
+		}
+
+		value, err := strconv.ParseFloat(string(token), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", token)
+		}
+
+		return &Float{Value: value}, nil
+	case string:
+		return &String{Value: token}, nil
+	case json.Delim:
+		if token == '[' {
+			elements := []Object{}
+			for dec.More() {
+				el, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				elements = append(elements, el)
+			}
+
+			// NOTE: 閉じ括弧を読み飛ばす
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+
+			return &Array{Elements: elements}, nil
+		}
+
+		hash := &Hash{}
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			hash.Set(&String{Value: keyToken.(string)}, value)
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return hash, nil
+	}
+
+	return nil, fmt.Errorf("unexpected token %v", token)
+}
+
+func encodeJSON(buf *bytes.Buffer, obj Object, sortKeys bool, visited visitedObjects) error {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		buf.WriteString("null")
+	case *Boolean:
+		buf.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		buf.WriteString(obj.Inspect())
+	case *BigInt:
+		buf.WriteString(obj.Inspect())
+	case *Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return fmt.Errorf("cannot encode %s as JSON", obj.Inspect())
+		}
+
+		// NOTE: `Inspect()`は`1.0`のように小数点を補うので、デコードしても小数のまま戻る
+		buf.WriteString(obj.Inspect())
+	case *String:
+		encodeJSONString(buf, obj.Value)
+	case *Array:
+		if !visited.enter(obj) {
+			return fmt.Errorf("cannot encode cyclic %s as JSON", obj.Type())
+		}
+		defer visited.leave(obj)
+
+		buf.WriteByte('[')
+		for i, el := range obj.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeJSON(buf, el, sortKeys, visited); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *Hash:
+		if !visited.enter(obj) {
+			return fmt.Errorf("cannot encode cyclic %s as JSON", obj.Type())
+		}
+		defer visited.leave(obj)
+
+		pairs := obj.Pairs()
+		for _, pair := range pairs {
+			if _, ok := pair.Key.(*String); !ok {
+				return fmt.Errorf("cannot encode hash key %s as JSON, keys must be STRING", pair.Key.Type())
+			}
+		}
+
+		if sortKeys {
+			pairs = append([]HashPair{}, pairs...)
+			sort.SliceStable(pairs, func(i, j int) bool {
+				return pairs[i].Key.(*String).Value < pairs[j].Key.(*String).Value
+			})
+		}
+
+		buf.WriteByte('{')
+		for i, pair := range pairs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			encodeJSONString(buf, pair.Key.(*String).Value)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, pair.Value, sortKeys, visited); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot encode %s as JSON", obj.Type())
+	}
+
+	return nil
+}
+
+// NOTE: `json.Marshal`は`<`などをエスケープしてしまうので、エスケープしない`Encoder`を使う
+func encodeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	// NOTE: `Encode`が末尾に付ける改行を取り除く
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,177 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+)
+
+// NOTE: 普通のGoの関数を組み込み関数として呼べるようにする。引数と戻り値はMonkeyのオブジェクトと相互に変換し、
+// 引数の数や型が合わない場合はMonkeyのエラーを返す。最後の戻り値が`error`の場合、nilでなければMonkeyのエラーにする
+func WrapFunction(name string, fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s is not a function: %T", name, fn)
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+
+		if typeName(in) == "" {
+			return nil, fmt.Errorf("unsupported parameter type of %s: %s", name, in)
+		}
+	}
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	numResults := t.NumOut()
+	if returnsError {
+		numResults--
+	}
+
+	if numResults > 1 {
+		return nil, fmt.Errorf("%s must return at most one value and an error", name)
+	}
+	if numResults == 1 && typeName(t.Out(0)) == "" {
+		return nil, fmt.Errorf("unsupported return type of %s: %s", name, t.Out(0))
+	}
+
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			in, errObj := convertArguments(name, t, args)
+			if errObj != nil {
+				return errObj
+			}
+
+			out := v.Call(in)
+
+			if returnsError {
+				if err, ok := out[len(out)-1].Interface().(error); ok && err != nil {
+					return newError("%s", err)
+				}
+			}
+
+			if numResults == 0 {
+				return nil
+			}
+
+			result, err := fromGoValue(out[0])
+			if err != nil {
+				return newError("%s", err)
+			}
+
+			return result
+		},
+	}, nil
+}
+
+func convertArguments(name string, t reflect.Type, args []Object) ([]reflect.Value, *Error) {
+	numParams := t.NumIn()
+
+	if t.IsVariadic() {
+		if len(args) < numParams-1 {
+			return nil, newError("wrong number of arguments. got=%d, want>=%d", len(args), numParams-1)
+		}
+	} else if len(args) != numParams {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), numParams)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if t.IsVariadic() && i >= numParams-1 {
+			paramType = t.In(numParams - 1).Elem()
+		} else {
+			paramType = t.In(i)
+		}
+
+		value := reflect.New(paramType).Elem()
+		if err := assignObject(arg, value, visitedObjects{}); err != nil {
+			// NOTE: 型そのものが違う場合は、組み込み関数と同じ形式のメッセージにする
+			if typeName(paramType) != arg.Type() && paramType.Kind() != reflect.Interface {
+				return nil, newError(
+					"argument %d to `%s` must be %s, got %s",
+					i+1,
+					name,
+					typeName(paramType),
+					arg.Type(),
+				)
+			}
+
+			return nil, newError("argument %d to `%s`: %s", i+1, name, err)
+		}
+
+		in[i] = value
+	}
+
+	return in, nil
+}
+
+// NOTE: エラーメッセージに使う、Goの型に対応するMonkeyの型の名前。対応していない型なら空文字列
+func typeName(t reflect.Type) ObjectType {
+	return typeNameOf(t, map[reflect.Type]bool{})
+}
+
+// NOTE: `type List []List`のように自身を要素に含む型もあるので、`visiting`でたどっている途中の型を覚えておく。
+// 途中の型に戻ってきた要素は対応しているものとみなすが、ポインタだけで循環する型には対応しない
+func typeNameOf(t reflect.Type, visiting map[reflect.Type]bool) ObjectType {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	supported := func(elem reflect.Type) bool {
+		return visiting[elem] || typeNameOf(elem, visiting) != ""
+	}
+
+	if t.Implements(objectType) {
+		if t.Kind() == reflect.Ptr {
+			return reflect.New(t.Elem()).Interface().(Object).Type()
+		}
+
+		return ObjectType(t.String())
+	}
+
+	if t == bigIntType {
+		return INTEGER_OBJ
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if visiting[t.Elem()] {
+			return ""
+		}
+
+		return typeNameOf(t.Elem(), visiting)
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any object"
+		}
+	case reflect.Slice, reflect.Array:
+		if supported(t.Elem()) {
+			return ARRAY_OBJ
+		}
+	case reflect.Map:
+		if supported(t.Key()) && supported(t.Elem()) {
+			return HASH_OBJ
+		}
+	case reflect.Struct:
+		return HASH_OBJ
+	case reflect.Bool:
+		return BOOLEAN_OBJ
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return INTEGER_OBJ
+	case reflect.Float32, reflect.Float64:
+		return FLOAT_OBJ
+	case reflect.String:
+		return STRING_OBJ
+	}
+
+	return ""
+}
@@ -4,7 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/code"
+	"github.com/yasaichi-sandbox/monkey/token"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -17,9 +22,25 @@ type HashKey struct {
 
 type ObjectType string
 
+type StackFrame struct {
+	Function string         // 呼び出された関数の名前
+	CallSite token.Position // 関数が呼び出された位置
+}
+
+func (sf StackFrame) String() string {
+	name := sf.Function
+	if name == "" {
+		name = "<anonymous>"
+	}
+
+	return fmt.Sprintf("at %s (called at %s)", name, sf.CallSite)
+}
+
 const (
 	BOOLEAN_OBJ      = "BOOLEAN"
 	INTEGER_OBJ      = "INTEGER"
+	BIGINT_OBJ       = "BIGINT"
+	FLOAT_OBJ        = "FLOAT"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR"
@@ -28,9 +49,19 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+// NOTE: 真偽値とnullは値ごとに1つのインスタンスを使い回す。評価器は`==`や`!`をこれらの同一性で判定している
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
 )
 
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -43,15 +74,32 @@ type Array struct {
 	Elements []Object
 }
 
-func (a *Array) Inspect() string {
-	elements := []string{}
-	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
+func (a *Array) Inspect() string { return inspect(a, visitedObjects{}) }
+func (*Array) Type() ObjectType  { return ARRAY_OBJ }
+
+// NOTE: int64に収まらない整数。int64に収まる値は常にIntegerで表し、BigIntでは表さない
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte{byte(b.Value.Sign() + 1)}) // NOTE: 絶対値が同じ正負の値を区別するため
+	h.Write(b.Value.Bytes())
+
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+func (b *BigInt) Inspect() string { return b.Value.String() }
+func (*BigInt) Type() ObjectType  { return BIGINT_OBJ }
+
+// NOTE: int64に収まる値はInteger、収まらない値はBigIntにする
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
 	}
 
-	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+	return &BigInt{Value: value}
 }
-func (*Array) Type() ObjectType { return ARRAY_OBJ }
 
 type Boolean struct {
 	Value bool
@@ -78,14 +126,100 @@ type Builtin struct {
 func (*Builtin) Inspect() string  { return "builtin function" }
 func (*Builtin) Type() ObjectType { return BUILTIN_OBJ }
 
+// NOTE: VMで実行される関数。Monkeyのプログラムからは常にClosureとして見える
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object // 関数が参照している外側の変数。値ではなく、外側の関数と共有する変数そのもの
+}
+
+func (c *Closure) Inspect() string { return fmt.Sprintf("Closure[%p]", c) }
+
+// NOTE: エラーメッセージなどが評価器と同じになるように、評価器の関数と同じ型として扱う
+func (*Closure) Type() ObjectType { return FUNCTION_OBJ }
+
+type CompiledFunction struct {
+	Name          string // `let`で束縛された名前。無名関数の場合は空文字列
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Positions     map[int]token.Position // 命令のオフセットから、その命令を生成したノードの位置を引く
+	LocalNames    []string               // ローカル変数の名前。実行時のエラーメッセージに使う
+	FreeNames     []string               // 自由変数の名前。同上
+}
+
+func (cf *CompiledFunction) Inspect() string { return fmt.Sprintf("CompiledFunction[%p]", cf) }
+func (*CompiledFunction) Type() ObjectType   { return COMPILED_FUNCTION_OBJ }
+
+// NOTE: 実行環境が課した制限によって評価を打ち切った場合のエラーの種類。
+// スクリプト自体の誤りによるエラーでは空文字列になる
+type ErrorKind string
+
+const (
+	CANCELED                  ErrorKind = "CANCELED"
+	DEADLINE_EXCEEDED         ErrorKind = "DEADLINE_EXCEEDED"
+	STEP_LIMIT_EXCEEDED       ErrorKind = "STEP_LIMIT_EXCEEDED"
+	ALLOCATION_LIMIT_EXCEEDED ErrorKind = "ALLOCATION_LIMIT_EXCEEDED"
+	RECURSION_LIMIT_EXCEEDED  ErrorKind = "RECURSION_LIMIT_EXCEEDED"
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Pos     token.Position // エラーが起きたノードの位置
+	Stack   []StackFrame   // エラーが起きた時点で実行中だった関数。内側の呼び出しが先頭に来る
+}
+
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: ")
+	if e.Pos.IsValid() {
+		out.WriteString(e.Pos.String() + ": ")
+	}
+	out.WriteString(e.Message)
+
+	for _, frame := range e.Stack {
+		out.WriteString("\n\t" + frame.String())
+	}
+
+	return out.String()
 }
+func (*Error) Type() ObjectType { return ERROR_OBJ }
 
-func (e *Error) Inspect() string { return "ERROR: " + e.Message }
-func (*Error) Type() ObjectType  { return ERROR_OBJ }
+// NOTE: VMでは実行時エラーをGoの`error`として返すので、そのインターフェースも満たしておく
+func (e *Error) Error() string { return e.Message }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) HashKey() HashKey {
+	// NOTE: `1 == 1.0`が真になるので、整数値と等しい小数は同じ値の整数と同じハッシュキーにする
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if math.MinInt64 <= f.Value && f.Value < math.MaxInt64 {
+			return (&Integer{Value: int64(f.Value)}).HashKey()
+		}
+
+		value, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInt{Value: value}).HashKey()
+	}
+
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+	// NOTE: `3.0`が`3`と表示されると整数と区別がつかないので、小数点を補う
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+func (*Float) Type() ObjectType { return FLOAT_OBJ }
 
 type Function struct {
+	Name       string // `let`で束縛された名前。無名関数の場合は空文字列
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -114,20 +248,71 @@ type HashPair struct {
 	Value Object
 }
 
+// NOTE: キーを挿入された順に並べておくため、ペアはスライスで持ち、検索用の索引を別に持つ。
+// 異なるキーのハッシュ値が衝突することもあるので、同じハッシュ値を持つペアを`next`で数珠つなぎにしておき、
+// 検索するときはキーの値そのものを比べる。ゼロ値は空のハッシュとして使える
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs []HashPair
+	index map[HashKey]int // NOTE: キーのハッシュ値から、そのハッシュ値を持つ最後に挿入されたペアの添字を引く
+	next  []int           // NOTE: 同じハッシュ値を持つ、ひとつ前に挿入されたペアの添字。なければ-1
 }
 
-func (h *Hash) Inspect() string {
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, pair.Key.Inspect()+":"+pair.Value.Inspect())
+// NOTE: キーが見つからなければ`ok`はfalseになる
+func (h *Hash) Get(key Hashable) (value Object, ok bool) {
+	i, ok := h.find(key, key.HashKey())
+	if !ok {
+		return nil, false
 	}
 
-	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	return h.pairs[i].Value, true
 }
+
+func (h *Hash) Inspect() string { return inspect(h, visitedObjects{}) }
+
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// NOTE: 挿入順に並んだペアを返す。呼び出し側で書き換えてはいけない
+func (h *Hash) Pairs() []HashPair { return h.pairs }
+
+// NOTE: 既にあるキーの場合は値だけを置き換え、並び順は最初に挿入されたときのままにする
+func (h *Hash) Set(key Hashable, value Object) {
+	if h.index == nil {
+		h.index = map[HashKey]int{}
+	}
+
+	hashKey := key.HashKey()
+	if i, ok := h.find(key, hashKey); ok {
+		h.pairs[i].Value = value
+		return
+	}
+
+	prev, ok := h.index[hashKey]
+	if !ok {
+		prev = -1
+	}
+
+	h.index[hashKey] = len(h.pairs)
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+	h.next = append(h.next, prev)
+}
+
 func (*Hash) Type() ObjectType { return HASH_OBJ }
 
+func (h *Hash) find(key Hashable, hashKey HashKey) (int, bool) {
+	i, ok := h.index[hashKey]
+	if !ok {
+		return 0, false
+	}
+
+	for ; i >= 0; i = h.next[i] {
+		if Equal(h.pairs[i].Key, key) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
 type Integer struct {
 	Value int64
 }
@@ -168,8 +353,11 @@ func (s *String) Inspect() string { return s.Value }
 func (*String) Type() ObjectType  { return STRING_OBJ }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool // `const`で束縛した名前
+	outer  *Environment
+
+	CallDepth int // この環境で実行中の関数呼び出しのネストの深さ。トップレベルは0
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -183,6 +371,18 @@ func NewEnvironment() *Environment {
 	return &Environment{store: map[string]Object{}}
 }
 
+// NOTE: 既にある束縛のうち最も内側のものを書き換える。どこにも束縛されていなければfalseを返す
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+
+	return false
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	if obj, ok := e.store[name]; ok || e.outer == nil {
 		return obj, ok
@@ -193,7 +393,84 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// NOTE: `name`の最も内側の束縛が`const`によるものかどうか
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.consts[name]
+		}
+	}
+
+	return false
+}
+
+// NOTE: この環境自身に`const`による`name`の束縛があるかどうか。外側の環境は見ない
+func (e *Environment) IsLocalConst(name string) bool {
+	return e.consts[name]
+}
+
+// NOTE: `Set`は定数かどうかに関わらず束縛し直す。定数の再宣言を禁止するのは呼び出し側の役目
 func (e *Environment) Set(name string, val Object) Object {
+	delete(e.consts, name)
+	e.store[name] = val
+	return val
+}
+
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = map[string]bool{}
+	}
+
 	e.store[name] = val
+	e.consts[name] = true
 	return val
 }
+
+// NOTE: 配列とハッシュは代入で自分自身を含むことがあるので、たどっている途中の値を記録して無限に再帰しないようにする。
+// 同じ値を別々の場所から参照するのは構わないので、たどり終えた値は忘れる
+type visitedObjects map[Object]bool
+
+// NOTE: 既にたどっている途中の値ならfalseを返す。trueを返した場合、たどり終えたら`leave`を呼ぶ
+func (v visitedObjects) enter(obj Object) bool {
+	if v[obj] {
+		return false
+	}
+
+	v[obj] = true
+
+	return true
+}
+
+func (v visitedObjects) leave(obj Object) { delete(v, obj) }
+
+// NOTE: 表示している途中の配列やハッシュに戻ってきたら、中身の代わりに`[...]`や`{...}`と表示する
+func inspect(obj Object, visited visitedObjects) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if !visited.enter(obj) {
+			return "[...]"
+		}
+		defer visited.leave(obj)
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspect(e, visited))
+		}
+
+		return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+	case *Hash:
+		if !visited.enter(obj) {
+			return "{...}"
+		}
+		defer visited.leave(obj)
+
+		pairs := []string{}
+		for _, pair := range obj.pairs {
+			pairs = append(pairs, inspect(pair.Key, visited)+":"+inspect(pair.Value, visited))
+		}
+
+		return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	}
+
+	return obj.Inspect()
+}
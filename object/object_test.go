@@ -1,10 +1,30 @@
 package object_test
 
 import (
+	"errors"
 	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/token"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
 	"testing"
 )
 
+func TestBigIntHashKey(t *testing.T) {
+	big1, _ := new(big.Int).SetString("99999999999999999999", 10)
+	big2, _ := new(big.Int).SetString("99999999999999999999", 10)
+	neg, _ := new(big.Int).SetString("-99999999999999999999", 10)
+
+	if (&object.BigInt{Value: big1}).HashKey() != (&object.BigInt{Value: big2}).HashKey() {
+		t.Errorf("big integers with same content have different hash keys")
+	}
+
+	if (&object.BigInt{Value: big1}).HashKey() == (&object.BigInt{Value: neg}).HashKey() {
+		t.Errorf("big integers with different sign have same hash keys")
+	}
+}
+
 func TestBooleanHashKey(t *testing.T) {
 	true1 := &object.Boolean{Value: true}
 	true2 := &object.Boolean{Value: true}
@@ -24,6 +44,437 @@ func TestBooleanHashKey(t *testing.T) {
 	}
 }
 
+// NOTE: 代入で自分自身を含むようになった配列やハッシュも、無限に再帰せずに扱える
+func TestCyclicObjects(t *testing.T) {
+	array := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	array.Elements = append(array.Elements, array)
+
+	hash := newHash()
+	hash.Set(&object.String{Value: "self"}, hash)
+
+	nested := &object.Array{}
+	nested.Elements = []object.Object{&object.Array{Elements: []object.Object{nested}}}
+
+	tests := []struct {
+		input    object.Object
+		inspect  string
+		cyclicOf string
+	}{
+		{array, "[1, [...]]", "ARRAY"},
+		{hash, "{self:{...}}", "HASH"},
+		{&object.Array{Elements: []object.Object{hash}}, "[{self:{...}}]", "HASH"},
+		{nested, "[[[...]]]", "ARRAY"},
+	}
+
+	for _, tt := range tests {
+		if tt.input.Inspect() != tt.inspect {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.inspect, tt.input.Inspect())
+		}
+
+		expected := "cannot encode cyclic " + tt.cyclicOf + " as JSON"
+		if _, err := object.EncodeJSON(tt.input, false); err == nil || err.Error() != expected {
+			t.Errorf("wrong EncodeJSON error for %s. expected=%q, got=%v", tt.inspect, expected, err)
+		}
+
+		expected = "cannot convert cyclic " + tt.cyclicOf + " to a Go value"
+		if _, err := object.ToGo(tt.input); err == nil || err.Error() != expected {
+			t.Errorf("wrong ToGo error for %s. expected=%q, got=%v", tt.inspect, expected, err)
+		}
+
+		var value interface{}
+		if err := object.ToGoValue(tt.input, &value); err == nil || err.Error() != expected {
+			t.Errorf("wrong ToGoValue error for %s. expected=%q, got=%v", tt.inspect, expected, err)
+		}
+	}
+
+	var l nestedList
+	if err := object.ToGoValue(nested, &l); err == nil || err.Error() != "cannot convert cyclic ARRAY to a Go value" {
+		t.Errorf("wrong ToGoValue error for nestedList. got=%v", err)
+	}
+
+	// NOTE: 自分自身を含まなければ、同じ値を何度参照してもよい
+	inner := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	shared := &object.Array{Elements: []object.Object{inner, inner}}
+
+	if shared.Inspect() != "[[1], [1]]" {
+		t.Errorf("wrong Inspect() for shared values. got=%q", shared.Inspect())
+	}
+
+	if s, err := object.EncodeJSON(shared, false); err != nil || s != "[[1],[1]]" {
+		t.Errorf("wrong EncodeJSON for shared values. got=%q, %v", s, err)
+	}
+
+	if value, err := object.ToGo(shared); err != nil || !reflect.DeepEqual(value, []interface{}{[]interface{}{int64(1)}, []interface{}{int64(1)}}) {
+		t.Errorf("wrong ToGo for shared values. got=%#v, %v", value, err)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"null", "null"},
+		{"true", "true"},
+		{" 42 ", "42"},
+		{"-1.5e3", "-1500.0"},
+		{"2.0", "2.0"},
+		{"99999999999999999999", "99999999999999999999"},
+		{`"\u3042<>"`, "あ<>"},
+		{`[1, "two", [null]]`, "[1, two, [null]]"},
+		{`{"a": {"b": []}}`, "{a:{b:[]}}"},
+		{`{"a": 1, "a": 2}`, "{a:2}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := object.DecodeJSON(tt.input)
+		if err != nil {
+			t.Errorf("DecodeJSON(%q) returned an error: %s", tt.input, err)
+			continue
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("DecodeJSON(%q) is wrong. expected=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "unexpected end of JSON input"},
+		{"[1,", "unexpected end of JSON input"},
+		{"[1 2]", "invalid character '2' after array element"},
+		{"1 2", "unexpected data after top-level value"},
+		{"{1: 2}", "object member name must be a string"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := object.DecodeJSON(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	a := &object.String{Value: "a"}
+	b := &object.String{Value: "b"}
+	hash := newHash(
+		object.HashPair{Key: b, Value: &object.Array{Elements: []object.Object{
+			&object.Integer{Value: 1},
+			&object.Float{Value: 2},
+			object.NULL,
+		}}},
+		object.HashPair{Key: a, Value: &object.String{Value: "<\"x\">"}},
+	)
+
+	compact, err := object.EncodeJSON(hash, false)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned an error: %s", err)
+	}
+
+	expected := `{"b":[1,2.0,null],"a":"<\"x\">"}`
+	if compact != expected {
+		t.Errorf("wrong JSON. expected=%q, got=%q", expected, compact)
+	}
+
+	pretty, err := object.EncodeJSON(hash, true)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned an error: %s", err)
+	}
+
+	expected = "{\n  \"a\": \"<\\\"x\\\">\",\n  \"b\": [\n    1,\n    2.0,\n    null\n  ]\n}"
+	if pretty != expected {
+		t.Errorf("wrong pretty JSON. expected=%q, got=%q", expected, pretty)
+	}
+
+	one := &object.Integer{Value: 1}
+	errorTests := []struct {
+		input    object.Object
+		expected string
+	}{
+		{&object.Builtin{}, "cannot encode BUILTIN as JSON"},
+		{&object.Array{Elements: []object.Object{&object.Function{}}}, "cannot encode FUNCTION as JSON"},
+		{&object.Float{Value: math.Inf(1)}, "cannot encode +Inf as JSON"},
+		{
+			newHash(object.HashPair{Key: one, Value: one}),
+			"cannot encode hash key INTEGER as JSON, keys must be STRING",
+		},
+	}
+
+	for _, tt := range errorTests {
+		_, err := object.EncodeJSON(tt.input, false)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestErrorInspect(t *testing.T) {
+	tests := []struct {
+		err      *object.Error
+		expected string
+	}{
+		{
+			&object.Error{Message: "identifier not found: x"},
+			"ERROR: identifier not found: x",
+		},
+		{
+			&object.Error{
+				Message: "identifier not found: x",
+				Pos:     token.Position{Filename: "main.mk", Line: 2, Column: 5},
+				Stack: []object.StackFrame{
+					{Function: "", CallSite: token.Position{Filename: "main.mk", Line: 4, Column: 3}},
+					{Function: "main", CallSite: token.Position{Filename: "main.mk", Line: 6, Column: 1}},
+				},
+			},
+			"ERROR: main.mk:2:5: identifier not found: x\n" +
+				"\tat <anonymous> (called at main.mk:4:3)\n" +
+				"\tat main (called at main.mk:6:1)",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.err.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.expected, tt.err.Inspect())
+		}
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	half1 := &object.Float{Value: 0.5}
+	half2 := &object.Float{Value: 0.5}
+	quarter := &object.Float{Value: 0.25}
+	one := &object.Float{Value: 1.0}
+
+	if half1.HashKey() != half2.HashKey() {
+		t.Errorf("floats with same content have different hash keys")
+	}
+
+	if half1.HashKey() == quarter.HashKey() {
+		t.Errorf("floats with different content have same hash keys")
+	}
+
+	if one.HashKey() != (&object.Integer{Value: 1}).HashKey() {
+		t.Errorf("float equal to integer does not have same hash key as the integer")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{3, "3.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &object.Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+}
+
+type point struct {
+	X      int64  `monkey:"x"`
+	Y      int64  `monkey:"y,omitempty"`
+	Label  string `monkey:"-"`
+	hidden bool
+}
+
+// NOTE: 自分自身を参照できる型
+type node struct {
+	Name string
+	Next *node
+}
+
+type nestedList []nestedList
+
+type selfPointer *selfPointer
+
+func TestFromGo(t *testing.T) {
+	var nilSlice []int
+	var nilPointer *point
+
+	shared := &node{Name: "b"}
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{nilSlice, "null"},
+		{nilPointer, "null"},
+		{true, "true"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{big.NewInt(7), "7"},
+		{2.5, "2.5"},
+		{"monkey", "monkey"},
+		{[]string{"a", "b"}, "[a, b]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]int{"one": 1}, "{one:1}"},
+		{map[int][]int{1: {2}}, "{1:[2]}"},
+		{point{X: 1, Label: "origin"}, "{x:1}"},
+		{&point{Y: 2}, "{x:0, y:2}"},
+		{&object.String{Value: "as is"}, "as is"},
+		{[]*node{shared, shared}, "[{Name:b, Next:null}, {Name:b, Next:null}]"},
+		{nestedList{{}, {{}}}, "[[], [[]]]"},
+	}
+
+	for _, tt := range tests {
+		obj, err := object.FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) returned an error: %s", tt.input, err)
+			continue
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) is wrong. expected=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	cyclicNode := &node{Name: "a"}
+	cyclicNode.Next = &node{Name: "b", Next: cyclicNode}
+
+	cyclicMap := map[string]interface{}{}
+	cyclicMap["self"] = cyclicMap
+
+	cyclicSlice := []interface{}{1, nil}
+	cyclicSlice[1] = cyclicSlice
+
+	errorTests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{cyclicNode, "cannot convert cyclic *object_test.node to a Monkey object"},
+		{cyclicMap, "cannot convert cyclic map[string]interface {} to a Monkey object"},
+		{cyclicSlice, "cannot convert cyclic []interface {} to a Monkey object"},
+		{make(chan int), "cannot convert chan int to a Monkey object"},
+		{[]func(){nil}, "cannot convert func() to a Monkey object"},
+		{map[[1]int]int{{1}: 1}, "unusable as hash key: [1]int"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := object.FromGo(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %T. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// NOTE: 衝突するハッシュ値を持つ文字列を見つけるのは難しいので、常に同じハッシュ値を返すキーで試す
+type collidingKey struct {
+	name string
+}
+
+func (k collidingKey) HashKey() object.HashKey {
+	return object.HashKey{Type: k.Type(), Value: 42}
+}
+func (k collidingKey) Inspect() string       { return k.name }
+func (collidingKey) Type() object.ObjectType { return "COLLIDING" }
+
+func TestHashKeyCollisions(t *testing.T) {
+	hash := &object.Hash{}
+	hash.Set(collidingKey{"a"}, &object.Integer{Value: 1})
+	hash.Set(collidingKey{"b"}, &object.Integer{Value: 2})
+	hash.Set(collidingKey{"c"}, &object.Integer{Value: 3})
+	hash.Set(collidingKey{"b"}, &object.Integer{Value: 20})
+
+	if hash.Inspect() != "{a:1, b:20, c:3}" {
+		t.Errorf("wrong Inspect. got=%q", hash.Inspect())
+	}
+
+	tests := []struct {
+		key      object.Hashable
+		expected object.Object
+	}{
+		{collidingKey{"a"}, &object.Integer{Value: 1}},
+		{collidingKey{"b"}, &object.Integer{Value: 20}},
+		{collidingKey{"c"}, &object.Integer{Value: 3}},
+		{collidingKey{"d"}, nil},
+	}
+
+	for _, tt := range tests {
+		value, ok := hash.Get(tt.key)
+		if tt.expected == nil {
+			if ok {
+				t.Errorf("found a value for %s. got=%s", tt.key.Inspect(), value.Inspect())
+			}
+			continue
+		}
+
+		if !ok || value.Inspect() != tt.expected.Inspect() {
+			t.Errorf("wrong value for %s. want=%s, got=%v", tt.key.Inspect(), tt.expected.Inspect(), value)
+		}
+	}
+
+	// NOTE: ハッシュキーが等しい数値は、型が違っても同じキーとして扱う
+	big1, _ := new(big.Int).SetString("99999999999999999999", 10)
+	numbers := &object.Hash{}
+	numbers.Set(&object.Integer{Value: 1}, object.TRUE)
+	numbers.Set(&object.BigInt{Value: big1}, object.TRUE)
+	numbers.Set(&object.Float{Value: math.NaN()}, object.TRUE)
+
+	big2, _ := new(big.Int).SetString("99999999999999999999", 10)
+	numberTests := []struct {
+		key   object.Hashable
+		found bool
+	}{
+		{&object.Float{Value: 1}, true},
+		{&object.BigInt{Value: big2}, true},
+		{&object.Float{Value: 1e20}, false},
+		{&object.Float{Value: math.NaN()}, true},
+	}
+
+	for _, tt := range numberTests {
+		if _, ok := numbers.Get(tt.key); ok != tt.found {
+			t.Errorf("wrong result of Get(%s). want=%t, got=%t", tt.key.Inspect(), tt.found, ok)
+		}
+	}
+
+	if numbers.Len() != 3 {
+		t.Errorf("wrong length. got=%d", numbers.Len())
+	}
+}
+
+func TestHashSet(t *testing.T) {
+	one := &object.String{Value: "one"}
+	two := &object.Integer{Value: 2}
+
+	hash := &object.Hash{}
+	hash.Set(one, &object.Integer{Value: 1})
+	hash.Set(two, object.TRUE)
+	hash.Set(object.FALSE, object.NULL)
+
+	// NOTE: 既にあるキーに代入しても並び順は変わらない
+	hash.Set(&object.String{Value: "one"}, &object.Integer{Value: 10})
+
+	if hash.Inspect() != "{one:10, 2:true, false:null}" {
+		t.Errorf("wrong Inspect. got=%q", hash.Inspect())
+	}
+
+	if hash.Len() != 3 {
+		t.Errorf("wrong length. got=%d", hash.Len())
+	}
+
+	if value, ok := hash.Get(&object.Integer{Value: 2}); !ok || value != object.TRUE {
+		t.Errorf("wrong value for 2. got=%v (ok=%t)", value, ok)
+	}
+
+	if _, ok := hash.Get(&object.String{Value: "two"}); ok {
+		t.Errorf("found a value for a missing key")
+	}
+}
+
 func TestIntegerHashKey(t *testing.T) {
 	one1 := &object.Integer{Value: 1}
 	one2 := &object.Integer{Value: 1}
@@ -61,3 +512,207 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestToGo(t *testing.T) {
+	bigValue, _ := new(big.Int).SetString("99999999999999999999", 10)
+	one := &object.String{Value: "one"}
+	two := &object.Integer{Value: 2}
+
+	tests := []struct {
+		input    object.Object
+		expected interface{}
+	}{
+		{object.NULL, nil},
+		{object.TRUE, true},
+		{&object.Integer{Value: 42}, int64(42)},
+		{&object.BigInt{Value: bigValue}, bigValue},
+		{&object.Float{Value: 2.5}, 2.5},
+		{&object.String{Value: "monkey"}, "monkey"},
+		{
+			&object.Array{Elements: []object.Object{two, one, object.NULL}},
+			[]interface{}{int64(2), "one", nil},
+		},
+		{
+			newHash(object.HashPair{Key: one, Value: two}),
+			map[string]interface{}{"one": int64(2)},
+		},
+		{
+			newHash(object.HashPair{Key: one, Value: two}, object.HashPair{Key: two, Value: one}),
+			map[interface{}]interface{}{"one": int64(2), int64(2): "one"},
+		},
+	}
+
+	for _, tt := range tests {
+		value, err := object.ToGo(tt.input)
+		if err != nil {
+			t.Errorf("ToGo(%s) returned an error: %s", tt.input.Inspect(), err)
+			continue
+		}
+
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("ToGo(%s) is wrong. expected=%#v, got=%#v", tt.input.Inspect(), tt.expected, value)
+		}
+	}
+
+	_, err := object.ToGo(&object.Builtin{})
+	if err == nil || err.Error() != "cannot convert BUILTIN to a Go value" {
+		t.Errorf("wrong error for BUILTIN. got=%v", err)
+	}
+}
+
+func TestToGoValue(t *testing.T) {
+	x := &object.String{Value: "x"}
+	y := &object.String{Value: "y"}
+	label := &object.String{Value: "Label"}
+	hash := newHash(
+		object.HashPair{Key: x, Value: &object.Integer{Value: 1}},
+		object.HashPair{Key: y, Value: &object.Integer{Value: 2}},
+		object.HashPair{Key: label, Value: &object.String{Value: "ignored"}},
+	)
+
+	var p point
+	if err := object.ToGoValue(hash, &p); err != nil {
+		t.Fatalf("ToGoValue returned an error: %s", err)
+	}
+	if p != (point{X: 1, Y: 2}) {
+		t.Errorf("wrong struct. got=%+v", p)
+	}
+
+	var counts map[string]uint8
+	if err := object.ToGoValue(newHash(object.HashPair{Key: x, Value: &object.Integer{Value: 3}}), &counts); err != nil {
+		t.Fatalf("ToGoValue returned an error: %s", err)
+	}
+	if !reflect.DeepEqual(counts, map[string]uint8{"x": 3}) {
+		t.Errorf("wrong map. got=%#v", counts)
+	}
+
+	var ratios []float64
+	if err := object.ToGoValue(&object.Array{Elements: []object.Object{
+		&object.Integer{Value: 1},
+		&object.Float{Value: 0.5},
+	}}, &ratios); err != nil {
+		t.Fatalf("ToGoValue returned an error: %s", err)
+	}
+	if !reflect.DeepEqual(ratios, []float64{1, 0.5}) {
+		t.Errorf("wrong slice. got=%#v", ratios)
+	}
+
+	var (
+		b   bool
+		i8  int8
+		n   int
+		arr [2]int
+	)
+
+	errorTests := []struct {
+		input    object.Object
+		target   interface{}
+		expected string
+	}{
+		{&object.Integer{Value: 1}, &b, "cannot convert INTEGER to bool"},
+		{&object.Integer{Value: 128}, &i8, "128 is out of range for int8"},
+		{object.NULL, &n, "cannot convert NULL to int"},
+		{&object.Array{Elements: []object.Object{}}, &arr, "cannot convert ARRAY of length 0 to [2]int"},
+		{object.TRUE, n, "target must be a non-nil pointer, got int"},
+	}
+
+	for _, tt := range errorTests {
+		err := object.ToGoValue(tt.input, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestWrapFunction(t *testing.T) {
+	repeat, err := object.WrapFunction("repeat", func(n int64, s string) (string, error) {
+		if n < 0 {
+			return "", errors.New("negative count")
+		}
+
+		return strings.Repeat(s, int(n)), nil
+	})
+	if err != nil {
+		t.Fatalf("WrapFunction returned an error: %s", err)
+	}
+
+	sum, err := object.WrapFunction("sum", func(xs ...float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+
+		return total
+	})
+	if err != nil {
+		t.Fatalf("WrapFunction returned an error: %s", err)
+	}
+
+	small, err := object.WrapFunction("small", func(n uint8) bool { return n < 10 })
+	if err != nil {
+		t.Fatalf("WrapFunction returned an error: %s", err)
+	}
+
+	depth, err := object.WrapFunction("depth", func(l nestedList) int64 {
+		d := int64(0)
+		for len(l) > 0 {
+			l = l[0]
+			d++
+		}
+
+		return d
+	})
+	if err != nil {
+		t.Fatalf("WrapFunction returned an error: %s", err)
+	}
+
+	tests := []struct {
+		builtin  *object.Builtin
+		args     []object.Object
+		expected string
+	}{
+		{repeat, []object.Object{&object.Integer{Value: 3}, &object.String{Value: "ab"}}, "ababab"},
+		{repeat, []object.Object{&object.Integer{Value: 3}}, "ERROR: wrong number of arguments. got=1, want=2"},
+		{repeat, []object.Object{&object.String{Value: "ab"}, &object.String{Value: "ab"}}, "ERROR: argument 1 to `repeat` must be INTEGER, got STRING"},
+		{repeat, []object.Object{&object.Integer{Value: -1}, &object.String{Value: "ab"}}, "ERROR: negative count"},
+		{sum, []object.Object{}, "0.0"},
+		{sum, []object.Object{&object.Integer{Value: 1}, &object.Float{Value: 2.5}}, "3.5"},
+		{sum, []object.Object{object.TRUE}, "ERROR: argument 1 to `sum` must be FLOAT, got BOOLEAN"},
+		{small, []object.Object{&object.Integer{Value: 3}}, "true"},
+		{small, []object.Object{&object.Integer{Value: 256}}, "ERROR: argument 1 to `small`: 256 is out of range for uint8"},
+		{depth, []object.Object{&object.Array{Elements: []object.Object{&object.Array{}}}}, "1"},
+	}
+
+	for _, tt := range tests {
+		result := tt.builtin.Fn(tt.args...)
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result. expected=%q, got=%q", tt.expected, result.Inspect())
+		}
+	}
+
+	if result := small.Fn(&object.Integer{Value: 3}); result != object.TRUE {
+		t.Errorf("boolean result is not object.TRUE. got=%T (%+v)", result, result)
+	}
+
+	unsupported := []interface{}{
+		42,
+		func(ch chan int) {},
+		func() (int, string) { return 0, "" },
+		func(p selfPointer) {},
+	}
+
+	for _, fn := range unsupported {
+		if _, err := object.WrapFunction("f", fn); err == nil {
+			t.Errorf("WrapFunction(%T) did not return an error", fn)
+		}
+	}
+}
+
+func newHash(pairs ...object.HashPair) *object.Hash {
+	hash := &object.Hash{}
+	for _, pair := range pairs {
+		hash.Set(pair.Key.(object.Hashable), pair.Value)
+	}
+
+	return hash
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+var severityNames = map[Severity]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// NOTE: JSONにしたときに数値ではなく"error"などの文字列として出力されるようにする
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type DiagnosticCode string
+
+const (
+	UNEXPECTED_TOKEN    = "UNEXPECTED_TOKEN"
+	NO_PREFIX_PARSE_FN  = "NO_PREFIX_PARSE_FN"
+	INVALID_INTEGER     = "INVALID_INTEGER"
+	INVALID_FLOAT       = "INVALID_FLOAT"
+	ILLEGAL_TOKEN       = "ILLEGAL_TOKEN"
+	OUTSIDE_LOOP        = "OUTSIDE_LOOP"        // ループの外にある`break`や`continue`
+	INVALID_ASSIGNMENT  = "INVALID_ASSIGNMENT"  // 変数や添字以外、または定数への代入
+	REDECLARED_CONSTANT = "REDECLARED_CONSTANT" // 同じスコープでの定数の再宣言
+	SHADOWED_BINDING    = "SHADOWED_BINDING"    // 外側のスコープの束縛を隠す束縛（警告）
+)
+
+type Diagnostic struct {
+	Severity Severity       `json:"severity"`
+	Code     DiagnosticCode `json:"code"`
+	Pos      token.Position `json:"pos"`
+	End      token.Position `json:"end"`
+	Message  string         `json:"message"`
+	Expected string         `json:"expected,omitempty"` // 期待していたもの（例えばトークンの種類）
+	Found    string         `json:"found,omitempty"`    // 実際に見つかったもの
+}
+
+// NOTE: `error`インターフェースも満たしておくと、呼び出し側で扱いやすい
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
@@ -1,20 +1,24 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"github.com/yasaichi-sandbox/monkey/ast"
 	"github.com/yasaichi-sandbox/monkey/lexer"
 	"github.com/yasaichi-sandbox/monkey/token"
+	"io"
+	"math/big"
 	"strconv"
 )
 
 // NOTE: 定数宣言文内で代入値を省略すると、前回の代入と同じ値が代入されるんでしたね
 const (
 	LOWEST      = 1 + iota
+	ASSIGN      // = or += など
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * or / or %
 	PREFIX      // -x or !x
 	CALL        // myFuncion(x)
 	INDEX       // array[index]
@@ -23,16 +27,22 @@ const (
 // NOTE: constの値はcompile timeで評価・決定されるが、mapはruntimeで評価されるのでvarを
 // 使うしかない
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -43,43 +53,69 @@ type (
 
 type Parser struct {
 	l              *lexer.Lexer
-	errors         []string
+	diagnostics    []Diagnostic
 	curToken       token.Token
 	peekToken      token.Token
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// NOTE: エラー回復のための状態。depthはcurTokenまでに現れた閉じられていない`{`の数で、
+	// panickingは今解析している文でエラーが見つかったかどうか
+	depth     int
+	panicking bool
+
+	// NOTE: 今解析しているループのネストの深さ。関数リテラルの中では0に戻す
+	loopDepth int
+
+	// NOTE: 定数への代入などを静的に検査するためのスコープ
+	scope         *scope
+	warnShadowing bool
+
+	// NOTE: `EnableTracing`で出力先を設定した場合だけトレースする
+	traceOut   io.Writer
+	traceLevel int
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := Parser{l: l, errors: []string{}}
+	p := Parser{l: l, diagnostics: []Diagnostic{}}
+	p.enterScope()
 
 	p.prefixParseFns = map[token.TokenType]prefixParseFn{}
 	// NOTE: [レシーバ].[メソッド]の形で取り出した関数にはレシーバが埋め込まれる。ここらへん
 	// Pythonの挙動と全く同じ
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = map[token.TokenType]infixParseFn{}
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -87,8 +123,21 @@ func New(l *lexer.Lexer) *Parser {
 	return &p
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
+// NOTE: 警告も含めた全ての診断結果を返す
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+func (p *Parser) Errors() []Diagnostic {
+	errors := []Diagnostic{}
+
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			errors = append(errors, d)
+		}
+	}
+
+	return errors
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -132,11 +181,42 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// NOTE: 字句解析器がコメントを返すように設定されていても、構文解析では読み飛ばす
+	for p.peekTokenIs(token.COMMENT) {
+		p.peekToken = p.l.NextToken()
+	}
+
+	switch {
+	case p.curTokenIs(token.LBRACE):
+		p.depth++
+	case p.curTokenIs(token.RBRACE) && p.depth > 0:
+		p.depth--
+	}
+}
+
+func (p *Parser) addDiagnostic(d Diagnostic) {
+	if d.Severity == SeverityError {
+		// NOTE: 同じ文の中で2つ目以降に見つかったエラーは最初のエラーに起因するものなので報告しない
+		if p.panicking {
+			return
+		}
+
+		p.panicking = true
+	}
+
+	p.diagnostics = append(p.diagnostics, d)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addDiagnostic(Diagnostic{
+		Severity: SeverityError,
+		Code:     NO_PREFIX_PARSE_FN,
+		Pos:      p.curToken.Pos,
+		End:      p.curToken.End,
+		Message:  fmt.Sprintf("no prefix parse function for %s found", t),
+		Found:    string(t),
+	})
 }
 
 // [46, 48, 49]
@@ -144,10 +224,45 @@ func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.EndToken = p.curToken
 
 	return array
 }
 
+// counter += 1
+//         └ p.curToken
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier:
+		p.checkAssignable(target)
+	case *ast.IndexExpression:
+	default:
+		p.addDiagnostic(Diagnostic{
+			Severity: SeverityError,
+			Code:     INVALID_ASSIGNMENT,
+			Pos:      target.Pos(),
+			End:      target.End(),
+			Message:  fmt.Sprintf("cannot assign to %s", target.String()),
+			Found:    target.String(),
+		})
+
+		return nil
+	}
+
+	p.nextToken()
+
+	// NOTE: `a = b = 1`が`a = (b = 1)`になるように、右結合にする
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 // 46 > 48 == true;
 //             └ p.curToken
 func (p *Parser) parseBoolean() ast.Expression {
@@ -161,6 +276,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		Token:      p.curToken,
 		Statements: []ast.Statement{}, // NOTE: スライスは参照型なのでゼロ値はnil
 	}
+	depth := p.depth
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -169,22 +285,35 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 			block.Statements = append(block.Statements, stmt)
 		}
 
+		// NOTE: エラーのある文の解析中にこのブロックを閉じる`}`まで読んでしまった場合
+		if p.depth < depth {
+			break
+		}
+
 		p.nextToken()
 	}
 
+	block.EndToken = p.curToken
 	return block
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	defer p.untrace(p.trace("parseExpression"))
+
 	// NOTE: `parseExpression`が呼ばれたときのcurTokenは式の始まりなので必ず前置された
 	// トークン（≠演算子）のはず
+	start := p.curToken
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		return &ast.BadExpression{Token: start, EndToken: p.curToken}
 	}
 
 	leftExp := prefix()
+	if leftExp == nil {
+		return &ast.BadExpression{Token: start, EndToken: p.curToken}
+	}
 
 	// NOTE: ループの停止条件は 1. 次のトークンがセミコロンのとき または 2.現在の関数呼び出しの
 	// コンテクストの演算子が次の演算子トークンと優先順位が同じまたは高いとき、なのは読み取れるが、
@@ -198,12 +327,17 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.nextToken()
 
 		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return &ast.BadExpression{Token: start, EndToken: p.curToken}
+		}
 	}
 
 	return leftExp
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	defer p.untrace(p.trace("parseExpressionStatement"))
+
 	// NOTE: 今のところTokenの値としてこれが適切だとは思えない
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -221,6 +355,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.EndToken = p.curToken
 
 	return exp
 }
@@ -238,13 +373,17 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	p.nextToken() // NOTE: この時点で`p.curToken`は第1要素の場所
 	list = append(list, p.parseExpression(LOWEST))
 
-	for p.peekTokenIs(token.COMMA) {
+	for !p.panicking && p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken() // NOTE: この時点で`p.curToken`は第n(>=2)要素の場所
 
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
+	if p.panicking {
+		return nil
+	}
+
 	if !p.expectPeek(end) {
 		return nil
 	}
@@ -252,6 +391,69 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// keyakizaka * 4.6
+//               └ p.curToken
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.addDiagnostic(Diagnostic{
+			Severity: SeverityError,
+			Code:     INVALID_FLOAT,
+			Pos:      p.curToken.Pos,
+			End:      p.curToken.End,
+			Message:  fmt.Sprintf("could not parse %q as float", p.curToken.Literal),
+			Found:    p.curToken.Literal,
+		})
+
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+// for (x in [1, 2, 3]) { puts(x) }
+// └ p.curToken
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.enterScope()
+	p.declare(stmt.Variable, false)
+	stmt.Body = p.parseLoopBody()
+	p.leaveScope()
+
+	// NOTE: 式文と同じく、末尾にセミコロンを書いてもよい
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // let sakamichi = fn(ngzk, kykzk) { ngzk + kykzk; }
 //                  └ p.curToken
 func (p *Parser) parseFunctionLiteral() ast.Expression {
@@ -267,7 +469,17 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	p.enterScope()
+	for _, param := range lit.Parameters {
+		p.declare(param, false)
+	}
+
+	// NOTE: 関数の本体から外側のループを`break`することはできない
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+	p.leaveScope()
 
 	return lit
 }
@@ -318,9 +530,14 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 // { "keyakizaka": 46 }
 // └ p.curToken
 func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{Pairs: map[ast.Expression]ast.Expression{}}
+	hash := &ast.HashLiteral{
+		Token: p.curToken,
+		Pairs: []ast.HashPair{},
+	}
 	if p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
+		hash.EndToken = p.curToken
+
 		return hash
 	}
 
@@ -333,8 +550,11 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		}
 
 		p.nextToken() // NOTE: この時点で`p.curToken`は第n要素の値
-		hash.Pairs[key] = p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: p.parseExpression(LOWEST)})
 
+		if p.panicking {
+			return nil
+		}
 		if !p.peekTokenIs(token.COMMA) {
 			break
 		}
@@ -345,6 +565,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		return nil
 	}
 
+	hash.EndToken = p.curToken
 	return hash
 }
 
@@ -354,6 +575,34 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// @keyakizaka46
+// └ p.curToken
+func (p *Parser) parseIllegal() ast.Expression {
+	d := Diagnostic{
+		Severity: SeverityError,
+		Code:     ILLEGAL_TOKEN,
+		Pos:      p.curToken.Pos,
+		End:      p.curToken.End,
+		Message:  fmt.Sprintf("illegal token %q", p.curToken.Literal),
+		Found:    p.curToken.Literal,
+	}
+
+	// NOTE: 字句解析器がトークン内のエラーの理由を記録していればそちらを使う。
+	// 例えば不正なエスケープシーケンスであれば、その位置を指すようにする
+	for _, err := range p.l.Errors() {
+		if p.curToken.Pos.Offset <= err.Pos.Offset && err.Pos.Offset < p.curToken.End.Offset {
+			d.Pos = err.Pos
+			d.End = err.End
+			d.Message = err.Message
+			break
+		}
+	}
+
+	p.addDiagnostic(d)
+
+	return nil
+}
+
 // if (sakamichi > akb) { true } else { false }
 //  └ p.curToken
 func (p *Parser) parseIfExpression() ast.Expression {
@@ -380,6 +629,26 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
+		// NOTE: `else if`は、後ろの`if`式だけを含むブロックとして表す。評価器やコンパイラからは
+		// `else { if ... }`と区別がつかないので、そのまま扱える
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+
+			tok := p.curToken
+			alternative := p.parseIfExpression()
+			if alternative == nil {
+				return nil
+			}
+
+			expression.Alternative = &ast.BlockStatement{
+				Token:      tok,
+				Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: alternative}},
+				EndToken:   p.curToken,
+			}
+
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -403,12 +672,15 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 		return nil
 	}
 
+	exp.EndToken = p.curToken
 	return exp
 }
 
 // keyakizaka * 46
 //            └ p.curToken
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseInfixExpression"))
+
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
 		Left:     left,
@@ -429,9 +701,24 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+
+	// NOTE: int64に収まらない整数リテラルは多倍長整数として扱う
+	if errors.Is(err, strconv.ErrRange) {
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = value
+			return lit
+		}
+	}
+
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addDiagnostic(Diagnostic{
+			Severity: SeverityError,
+			Code:     INVALID_INTEGER,
+			Pos:      p.curToken.Pos,
+			End:      p.curToken.End,
+			Message:  fmt.Sprintf("could not parse %q as integer", p.curToken.Literal),
+			Found:    p.curToken.Literal,
+		})
 
 		return nil
 	}
@@ -466,12 +753,133 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		p.nextToken()
 	}
 
+	// NOTE: 評価器と同じく、値を解析し終えてから名前を登録する
+	p.declareBinding(stmt)
+
 	return stmt
 }
 
+// break;
+// └ p.curToken
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if p.loopDepth == 0 {
+		p.addDiagnostic(Diagnostic{
+			Severity: SeverityError,
+			Code:     OUTSIDE_LOOP,
+			Pos:      tok.Pos,
+			End:      tok.End,
+			Message:  fmt.Sprintf("%s outside loop", tok.Literal),
+			Found:    string(tok.Type),
+		})
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+
+	return &ast.ContinueStatement{Token: tok}
+}
+
+// NOTE: ループの本体のブロック。この中でだけ`break`と`continue`を書ける
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// [ngzk, ...rest] if ngzk > 46 => rest
+// └ p.curToken
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	// NOTE: パターンで束縛した名前は、その腕のガードと式の中でだけ使える
+	p.enterScope()
+	defer p.leaveScope()
+
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+	p.declarePattern(arm.Pattern)
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	p.nextToken() // NOTE: この時点で`p.curToken`は腕の式
+	// NOTE: `{`で始まる場合はハッシュリテラルではなくブロックとして読むので、複数の文を書ける。
+	// ハッシュリテラルを腕の値にする場合は`(`と`)`で囲む
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+	} else {
+		arm.Body = p.parseExpression(LOWEST)
+	}
+
+	return arm
+}
+
+// match (keyakizaka) { 46 => "sakamichi", _ => "other" }
+//  └ p.curToken
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{
+		Token: p.curToken,
+		Arms:  []ast.MatchArm{},
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken() // NOTE: この時点で`p.curToken`は第n腕のパターン
+		arm := p.parseMatchArm()
+
+		if arm == nil || p.panicking {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, *arm)
+
+		// NOTE: 最後の腕の後ろの`,`は省略してもしなくてもよい
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	expression.EndToken = p.curToken
+	return expression
+}
+
 // !nogizaka46;
 // └ p.curToken
 func (p *Parser) parsePrefixExpression() ast.Expression {
+	defer p.untrace(p.trace("parsePrefixExpression"))
+
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
@@ -501,14 +909,52 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	defer p.untrace(p.trace("parseStatement"))
+
+	var stmt ast.Statement
+
+	start := p.curToken
+	depth := p.depth
+
+	// NOTE: 関数リテラルのブロック内の文などは、外側の文とは独立してエラー回復を行う
+	panicking := p.panicking
+	p.panicking = false
+
+	// NOTE: 型付きのnilポインタをそのままインターフェースに代入するとnilでなくなってしまうので、
+	// nilでない場合のみ代入する
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if s := p.parseLetStatement(); s != nil {
+			stmt = s
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if s := p.parseReturnStatement(); s != nil {
+			stmt = s
+		}
+	case token.WHILE:
+		if s := p.parseWhileStatement(); s != nil {
+			stmt = s
+		}
+	case token.FOR:
+		if s := p.parseForStatement(); s != nil {
+			stmt = s
+		}
+	case token.BREAK, token.CONTINUE:
+		stmt = p.parseLoopControlStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
 	}
+
+	if p.panicking {
+		p.synchronize(depth)
+
+		if stmt == nil {
+			stmt = &ast.BadStatement{Token: start, EndToken: p.curToken}
+		}
+	}
+
+	p.panicking = panicking
+	return stmt
 }
 
 // "keyakizaka46"
@@ -517,14 +963,70 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// while (x < 10) { ... }
+// └ p.curToken
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.enterScope()
+	stmt.Body = p.parseLoopBody()
+	p.leaveScope()
+
+	// NOTE: 式文と同じく、末尾にセミコロンを書いてもよい
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf(
-		"expected next token to be %s, got %s instead",
-		t,
-		p.peekToken.Type,
-	)
+	p.addDiagnostic(Diagnostic{
+		Severity: SeverityError,
+		Code:     UNEXPECTED_TOKEN,
+		Pos:      p.peekToken.Pos,
+		End:      p.peekToken.End,
+		Message: fmt.Sprintf(
+			"expected next token to be %s, got %s instead",
+			t,
+			p.peekToken.Type,
+		),
+		Expected: string(t),
+		Found:    string(p.peekToken.Type),
+	})
+}
 
-	p.errors = append(p.errors, msg)
+// NOTE: エラーが見つかった文の残りを読み飛ばす。次の文の始まりが`p.peekToken`に来るか、
+// 文の末尾の`;`が`p.curToken`に来たところで止まる。文の途中で開いた`{}`の中は読み飛ばす
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && p.depth >= depth {
+		if p.depth == depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			switch p.peekToken.Type {
+			case token.LET, token.CONST, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.RBRACE, token.EOF:
+				return
+			}
+		}
+
+		p.nextToken()
+	}
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -1,13 +1,34 @@
 package parser_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/yasaichi-sandbox/monkey/ast"
 	"github.com/yasaichi-sandbox/monkey/lexer"
 	"github.com/yasaichi-sandbox/monkey/parser"
+	"reflect"
 	"testing"
 )
 
+func TestBigIntegerExpression(t *testing.T) {
+	input := "99999999999999999999;"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "99999999999999999999" {
+		t.Errorf("literal.Big not %s. got=%v", "99999999999999999999", literal.Big)
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -163,6 +184,200 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestConstStatement(t *testing.T) {
+	l := lexer.New("const x = 5;")
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false")
+	}
+	if stmt.String() != "const x = 5;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+	if !testLiteralExpression(t, stmt.Value, 5) {
+		return
+	}
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	l := lexer.New("let x 5;")
+	p := parser.New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("parser has wrong number of errors. got=%d", len(p.Errors()))
+	}
+
+	encoded, err := json.Marshal(p.Errors()[0])
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+
+	expected := `{"severity":"error","code":"UNEXPECTED_TOKEN",` +
+		`"pos":{"offset":6,"line":1,"column":7},` +
+		`"end":{"offset":7,"line":1,"column":8},` +
+		`"message":"expected next token to be =, got INT instead",` +
+		`"expected":"=","found":"INT"}`
+	if string(encoded) != expected {
+		t.Errorf("wrong JSON. expected=%s, got=%s", expected, encoded)
+	}
+}
+
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < 1) { 1 } else if (x < 2) { 2 } else { 3 }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("expression is not *ast.IfExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+
+	// NOTE: `else if`は、後ろの`if`式だけを含むブロックになる
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statements. got=%d", len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not *ast.IfExpression. got=%T", exp.Alternative.Statements[0])
+	}
+
+	if !testInfixExpression(t, alternative.Condition, "x", "<", 2) {
+		return
+	}
+	if alternative.Alternative == nil {
+		t.Fatalf("alternative.Alternative is nil")
+	}
+
+	if exp.End().String() != "1:50" {
+		t.Errorf("exp.End() wrong. want=%q, got=%q", "1:50", exp.End())
+	}
+}
+
+func TestFloatExpression(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue float64
+	}{
+		{"3.14;", 3.14},
+		{"0.5;", 0.5},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf(
+				"program has not enough statements. got=%d",
+				len(program.Statements),
+			)
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expectedValue {
+			t.Errorf("literal.Value not %g. got=%g", tt.expectedValue, literal.Value)
+		}
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in [1, 2]) { if (x > 1) { break; } continue }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+
+	if stmt.Iterable.String() != "[1, 2]" {
+		t.Errorf("stmt.Iterable wrong. got=%q", stmt.Iterable.String())
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[1] is not *ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+	}
+
+	expected := "for(x in [1, 2]) if(x > 1) break;continue;"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. want=%q, got=%q", expected, stmt.String())
+	}
+}
+
+// NOTE: ループの文も、式文と同じく末尾にセミコロンを書ける
+func TestLoopStatementsWithSemicolon(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let i = 0; while (i < 3) { i += 1 }; i", []string{"let i = 0;", "while(i < 3) (i += 1)", "i"}},
+		{"for (x in [1]) { x }; x", []string{"for(x in [1]) x", "x"}},
+		{"while (true) { break; }; 1", []string{"whiletrue break;", "1"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != len(tt.expected) {
+			t.Errorf("wrong number of statements for %q. want=%d, got=%d", tt.input, len(tt.expected), len(program.Statements))
+			continue
+		}
+
+		for i, stmt := range program.Statements {
+			if stmt.String() != tt.expected[i] {
+				t.Errorf("wrong statement %d for %q. want=%q, got=%q", i, tt.input, tt.expected[i], stmt.String())
+			}
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := "fn(x, y) { x + y };"
 
@@ -525,6 +740,198 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { 1 => "one", "a" + "b" => y, _ => z, }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	expectedArms := []struct {
+		pattern string
+		body    string
+	}{
+		{"1", "one"},
+		{"(a + b)", "y"},
+		{"_", "z"},
+	}
+
+	if len(exp.Arms) != len(expectedArms) {
+		t.Fatalf("exp.Arms has wrong length. want=%d, got=%d", len(expectedArms), len(exp.Arms))
+	}
+
+	for i, expected := range expectedArms {
+		if exp.Arms[i].Pattern.String() != expected.pattern {
+			t.Errorf("exp.Arms[%d].Pattern wrong. want=%q, got=%q", i, expected.pattern, exp.Arms[i].Pattern.String())
+		}
+		if exp.Arms[i].Body.String() != expected.body {
+			t.Errorf("exp.Arms[%d].Body wrong. want=%q, got=%q", i, expected.body, exp.Arms[i].Body.String())
+		}
+	}
+
+	if exp.String() != "match(x) {1 => one, (a + b) => y, _ => z}" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedArm     string
+		expectedPattern interface{}
+	}{
+		{"match (v) { _ => 1 }", "_ => 1", &ast.IdentifierPattern{}},
+		{"match (v) { n: INTEGER => n }", "n: INTEGER => n", &ast.IdentifierPattern{}},
+		{"match (v) { -1 => 1 }", "(-1) => 1", &ast.ValuePattern{}},
+		{"match (v) { (x) => 1 }", "x => 1", &ast.ValuePattern{}},
+		{"match (v) { [] => 1 }", "[] => 1", &ast.ArrayPattern{}},
+		{"match (v) { [first, ...rest] => rest }", "[first, ...rest] => rest", &ast.ArrayPattern{}},
+		{"match (v) { [1, [a, _], s: STRING,] => a }", "[1, [a, _], s: STRING] => a", &ast.ArrayPattern{}},
+		{`match (v) { {"name": n, "tags": [t, ..._]} => t }`, "{name:n, tags:[t, ..._]} => t", &ast.HashPattern{}},
+		{"match (v) { n if n > 0 => n }", "n if (n > 0) => n", &ast.IdentifierPattern{}},
+		// NOTE: `{`で始まる腕の式はブロックになり、ハッシュリテラルは`(`と`)`で囲む
+		{"match (v) { n => { let m = n * 2; m } }", "n => {let m = (n * 2);m}", &ast.IdentifierPattern{}},
+		{`match (v) { _ => ({"a": 1}) }`, "_ => {a:1}", &ast.IdentifierPattern{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+		if !ok {
+			t.Fatalf("expression is not *ast.MatchExpression. got=%T", program.Statements[0])
+		}
+
+		if len(exp.Arms) != 1 {
+			t.Fatalf("exp.Arms does not contain 1 arms. got=%d", len(exp.Arms))
+		}
+
+		if exp.Arms[0].String() != tt.expectedArm {
+			t.Errorf("arm wrong. want=%q, got=%q", tt.expectedArm, exp.Arms[0].String())
+		}
+
+		if reflect.TypeOf(exp.Arms[0].Pattern) != reflect.TypeOf(tt.expectedPattern) {
+			t.Errorf("pattern type wrong. want=%T, got=%T", tt.expectedPattern, exp.Arms[0].Pattern)
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, [2][0]) * {"a": 1}["a"];`
+
+	tests := []struct {
+		node          func(*ast.Program) ast.Node
+		expectedPos   string
+		expectedEnd   string
+		expectedValue string
+	}{
+		{
+			func(p *ast.Program) ast.Node { return p.Statements[0] },
+			"1:1", "3:2", "let add = fn(x, y) {\n(x + y)\n};",
+		},
+		{
+			func(p *ast.Program) ast.Node {
+				return p.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+			},
+			"1:20", "3:2", "(x + y)",
+		},
+		{
+			func(p *ast.Program) ast.Node {
+				body := p.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+				return body.Statements[0]
+			},
+			"2:3", "2:8", "(x + y)",
+		},
+		{
+			func(p *ast.Program) ast.Node {
+				return p.Statements[1].(*ast.ExpressionStatement).Expression
+			},
+			"4:1", "4:31", `(add(1, ([2][0])) * ({a:1}[a]))`,
+		},
+		{
+			func(p *ast.Program) ast.Node {
+				exp := p.Statements[1].(*ast.ExpressionStatement).Expression
+				return exp.(*ast.InfixExpression).Left
+			},
+			"4:1", "4:15", "add(1, ([2][0]))",
+		},
+		{
+			func(p *ast.Program) ast.Node {
+				exp := p.Statements[1].(*ast.ExpressionStatement).Expression
+				return exp.(*ast.InfixExpression).Right.(*ast.IndexExpression).Left
+			},
+			"4:18", "4:26", "{a:1}",
+		},
+		{
+			func(p *ast.Program) ast.Node { return p },
+			"1:1", "4:31", "",
+		},
+	}
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	for i, tt := range tests {
+		node := tt.node(program)
+
+		if tt.expectedValue != "" && node.String() != tt.expectedValue {
+			t.Errorf(
+				"tests[%d] - node.String() wrong. expected=%q, got=%q",
+				i,
+				tt.expectedValue,
+				node.String(),
+			)
+		}
+
+		if node.Pos().String() != tt.expectedPos {
+			t.Errorf(
+				"tests[%d] - node.Pos() wrong. expected=%q, got=%q",
+				i,
+				tt.expectedPos,
+				node.Pos().String(),
+			)
+		}
+
+		if node.End().String() != tt.expectedEnd {
+			t.Errorf(
+				"tests[%d] - node.End() wrong. expected=%q, got=%q",
+				i,
+				tt.expectedEnd,
+				node.End().String(),
+			)
+		}
+	}
+}
+
 func TestOperatorPrecedenceParsing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -562,6 +969,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
 		{
 			"3 + 4; -5 * 5",
 			"(3 + 4)((-5) * 5)",
@@ -634,6 +1045,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"x[i + 1] *= 2 == y",
+			"((x[(i + 1)]) *= (2 == y))",
+		},
+		{
+			"a -= -1; b /= f(1)",
+			"(a -= (-1))(b /= f(1))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -649,6 +1072,287 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestParserErrorRecovery(t *testing.T) {
+	input := `let x 5;
+let = 10;
+let y = 1;
+add(1, 2;
+let f = fn() { let q = ; q + 1 };
+if (x { let a = 1; } else { 2 }
+let g = fn() { x + };
+let ok = 5;`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"1:7: expected next token to be =, got INT instead",
+		"2:5: expected next token to be IDENT, got = instead",
+		"4:9: expected next token to be ), got ; instead",
+		"5:24: no prefix parse function for ; found",
+		"6:7: expected next token to be ), got { instead",
+		"7:20: no prefix parse function for } found",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		for _, d := range errors {
+			t.Logf("parser error: %q", d.Error())
+		}
+		t.Fatalf(
+			"parser has wrong number of errors. want=%d, got=%d",
+			len(expectedErrors),
+			len(errors),
+		)
+	}
+
+	for i, expected := range expectedErrors {
+		if errors[i].Error() != expected {
+			t.Errorf(
+				"errors[%d] wrong. want=%q, got=%q",
+				i,
+				expected,
+				errors[i].Error(),
+			)
+		}
+	}
+
+	expectedStatements := []string{
+		"<bad statement>",
+		"<bad statement>",
+		"let y = 1;",
+		"add()",
+		"let f = fn() {\nlet q = <bad expression>;(q + 1)\n};",
+		"<bad expression>",
+		"let g = fn() {\n(x + <bad expression>)\n};",
+		"let ok = 5;",
+	}
+
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf(
+			"program has wrong number of statements. want=%d, got=%d",
+			len(expectedStatements),
+			len(program.Statements),
+		)
+	}
+
+	for i, expected := range expectedStatements {
+		if program.Statements[i].String() != expected {
+			t.Errorf(
+				"program.Statements[%d] wrong. want=%q, got=%q",
+				i,
+				expected,
+				program.Statements[i].String(),
+			)
+		}
+	}
+
+	if _, ok := program.Statements[0].(*ast.BadStatement); !ok {
+		t.Errorf(
+			"program.Statements[0] is not *ast.BadStatement. got=%T",
+			program.Statements[0],
+		)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedCode     parser.DiagnosticCode
+		expectedPos      string
+		expectedEnd      string
+		expectedMessage  string
+		expectedExpected string
+		expectedFound    string
+	}{
+		{
+			"let x 5;",
+			parser.UNEXPECTED_TOKEN,
+			"1:7",
+			"1:8",
+			"expected next token to be =, got INT instead",
+			"=",
+			"INT",
+		},
+		{
+			"let x = 1;\nadd(x;",
+			parser.UNEXPECTED_TOKEN,
+			"2:6",
+			"2:7",
+			"expected next token to be ), got ; instead",
+			")",
+			";",
+		},
+		{
+			"let x = 1;\n\n  ]",
+			parser.NO_PREFIX_PARSE_FN,
+			"3:3",
+			"3:4",
+			"no prefix parse function for ] found",
+			"",
+			"]",
+		},
+		{
+			"let x = 1; /* comment",
+			parser.ILLEGAL_TOKEN,
+			"1:12",
+			"1:22",
+			"unterminated block comment",
+			"",
+			"/* comment",
+		},
+		{
+			`let x = "foo\qbar";`,
+			parser.ILLEGAL_TOKEN,
+			"1:13",
+			"1:15",
+			"unknown escape sequence: \\q",
+			"",
+			`"foo\qbar"`,
+		},
+		{
+			`let x = "foo`,
+			parser.ILLEGAL_TOKEN,
+			"1:9",
+			"1:13",
+			"unterminated string",
+			"",
+			`"foo`,
+		},
+		{
+			"let x = @;",
+			parser.ILLEGAL_TOKEN,
+			"1:9",
+			"1:10",
+			"illegal token \"@\"",
+			"",
+			"@",
+		},
+		{
+			"1 = 2;",
+			parser.INVALID_ASSIGNMENT,
+			"1:1",
+			"1:2",
+			"cannot assign to 1",
+			"",
+			"1",
+		},
+		{
+			"let x = 1;\nf(x) += 1;",
+			parser.INVALID_ASSIGNMENT,
+			"2:1",
+			"2:5",
+			"cannot assign to f(x)",
+			"",
+			"f(x)",
+		},
+		{
+			"break;",
+			parser.OUTSIDE_LOOP,
+			"1:1",
+			"1:6",
+			"break outside loop",
+			"",
+			"BREAK",
+		},
+		{
+			"while (true) { let f = fn() { continue } }",
+			parser.OUTSIDE_LOOP,
+			"1:31",
+			"1:39",
+			"continue outside loop",
+			"",
+			"CONTINUE",
+		},
+		{
+			"match (x) { 1 2 }",
+			parser.UNEXPECTED_TOKEN,
+			"1:15",
+			"1:16",
+			"expected next token to be =>, got INT instead",
+			"=>",
+			"INT",
+		},
+		{
+			"match (x) { [...a, b] => 1 }",
+			parser.UNEXPECTED_TOKEN,
+			"1:18",
+			"1:19",
+			"expected next token to be ], got , instead",
+			"]",
+			",",
+		},
+		{
+			"match (x) { n: 1 => 1 }",
+			parser.UNEXPECTED_TOKEN,
+			"1:16",
+			"1:17",
+			"expected next token to be IDENT, got INT instead",
+			"IDENT",
+			"INT",
+		},
+		{
+			"const x = 1;\nlet f = fn() { x += 1 };",
+			parser.INVALID_ASSIGNMENT,
+			"2:16",
+			"2:17",
+			"cannot assign to constant x",
+			"",
+			"x",
+		},
+		{
+			"const x = 1;\nif (true) { let x = 2; }",
+			parser.REDECLARED_CONSTANT,
+			"2:17",
+			"2:18",
+			"cannot redeclare constant x",
+			"",
+			"x",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("parser has no errors for %q", tt.input)
+			continue
+		}
+
+		d := errors[0]
+		if d.Severity != parser.SeverityError {
+			t.Errorf("d.Severity wrong. expected=%s, got=%s", parser.SeverityError, d.Severity)
+		}
+		if d.Code != tt.expectedCode {
+			t.Errorf("d.Code wrong. expected=%q, got=%q", tt.expectedCode, d.Code)
+		}
+		if d.Pos.String() != tt.expectedPos {
+			t.Errorf("d.Pos wrong. expected=%q, got=%q", tt.expectedPos, d.Pos)
+		}
+		if d.End.String() != tt.expectedEnd {
+			t.Errorf("d.End wrong. expected=%q, got=%q", tt.expectedEnd, d.End)
+		}
+		if d.Message != tt.expectedMessage {
+			t.Errorf("d.Message wrong. expected=%q, got=%q", tt.expectedMessage, d.Message)
+		}
+		if d.Expected != tt.expectedExpected {
+			t.Errorf("d.Expected wrong. expected=%q, got=%q", tt.expectedExpected, d.Expected)
+		}
+		if d.Found != tt.expectedFound {
+			t.Errorf("d.Found wrong. expected=%q, got=%q", tt.expectedFound, d.Found)
+		}
+
+		expectedError := tt.expectedPos + ": " + tt.expectedMessage
+		if d.Error() != expectedError {
+			t.Errorf("d.Error() wrong. expected=%q, got=%q", expectedError, d.Error())
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -714,14 +1418,14 @@ func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
-		boolean, ok := key.(*ast.Boolean)
+	for _, pair := range hash.Pairs {
+		boolean, ok := pair.Key.(*ast.Boolean)
 		if !ok {
-			t.Errorf("key is not ast.BooleanLiteral. got=%T", key)
+			t.Errorf("key is not ast.BooleanLiteral. got=%T", pair.Key)
 			continue
 		}
 
-		testIntegerLiteral(t, value, expected[boolean.String()])
+		testIntegerLiteral(t, pair.Value, expected[boolean.String()])
 	}
 }
 
@@ -749,14 +1453,14 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
-		integer, ok := key.(*ast.IntegerLiteral)
+	for _, pair := range hash.Pairs {
+		integer, ok := pair.Key.(*ast.IntegerLiteral)
 		if !ok {
-			t.Errorf("key is not ast.IntegerLiteral. got=%T", key)
+			t.Errorf("key is not ast.IntegerLiteral. got=%T", pair.Key)
 			continue
 		}
 
-		testIntegerLiteral(t, value, expected[integer.String()])
+		testIntegerLiteral(t, pair.Value, expected[integer.String()])
 	}
 }
 
@@ -784,13 +1488,18 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		"three": 3,
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
 		}
 
-		testIntegerLiteral(t, value, expected[literal.String()])
+		testIntegerLiteral(t, pair.Value, expected[literal.String()])
+	}
+
+	// NOTE: キーはソースに書かれた順に並ぶ
+	if hash.String() != "{one:1, two:2, three:3}" {
+		t.Errorf("hash.String() is wrong. got=%q", hash.String())
 	}
 }
 
@@ -824,10 +1533,10 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
 			continue
 		}
 
@@ -837,7 +1546,7 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 			continue
 		}
 
-		testFunc(value)
+		testFunc(pair.Value)
 	}
 }
 
@@ -975,6 +1684,29 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingWithComments(t *testing.T) {
+	input := `// leading
+let x = 1; /* inline */ let y = x // trailing
++ 2;`
+
+	for _, emitComments := range []bool{false, true} {
+		l := lexer.New(input)
+		l.EmitComments(emitComments)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != "let x = 1;let y = (x + 2);" {
+			t.Errorf(
+				"emitComments=%t, program.String() wrong. got=%q",
+				emitComments,
+				program.String(),
+			)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -1015,6 +1747,53 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestShadowingWarnings(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedWarnings []string
+	}{
+		{"let x = 1; let f = fn() { let x = 2; x };", []string{"1:31: x shadows a binding in an outer scope"}},
+		{"const x = 1; let f = fn() { const x = 2; x };", []string{"1:35: x shadows a binding in an outer scope"}},
+		{"let x = 1; for (y in [1]) { let x = y; }", []string{"1:33: x shadows a binding in an outer scope"}},
+		{"const x = 1; while (false) { const x = 2; }", []string{"1:36: x shadows a binding in an outer scope"}},
+		// NOTE: 同じスコープでの束縛し直しや、関数の引数は対象外
+		{"let x = 1; let x = 2; let f = fn(x) { if (x) { let y = x; } };", []string{}},
+		{"let f = fn() { let x = 1; }; let x = 2;", []string{}},
+		// NOTE: パターンで束縛した名前は腕のスコープに入るので、外側の定数とは別の変数になる
+		{"const x = 1; match (2) { [x] => x += 1, x => x += 1 };", []string{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.WarnShadowing()
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := p.Diagnostics()
+		if len(warnings) != len(tt.expectedWarnings) {
+			t.Errorf("wrong number of warnings for %q. want=%d, got=%d", tt.input, len(tt.expectedWarnings), len(warnings))
+			continue
+		}
+
+		for i, expected := range tt.expectedWarnings {
+			if warnings[i].Severity != parser.SeverityWarning || warnings[i].Code != parser.SHADOWED_BINDING {
+				t.Errorf("warnings[%d] is not SHADOWED_BINDING warning. got=%s %s", i, warnings[i].Severity, warnings[i].Code)
+			}
+			if warnings[i].Error() != expected {
+				t.Errorf("warnings[%d] wrong. want=%q, got=%q", i, expected, warnings[i].Error())
+			}
+		}
+	}
+
+	// NOTE: `WarnShadowing`を呼ばなければ警告しない
+	p := parser.New(lexer.New(tests[0].input))
+	p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		t.Errorf("parser reported diagnostics without WarnShadowing. got=%d", len(p.Diagnostics()))
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 
@@ -1035,6 +1814,40 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { let y = x + 1; }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+
+	if !testLetStatement(t, stmt.Body.Statements[0], "y") {
+		return
+	}
+
+	if stmt.End().String() != "1:34" {
+		t.Errorf("stmt.End() wrong. got=%q", stmt.End())
+	}
+}
+
 func checkParserErrors(t *testing.T, p *parser.Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -1042,8 +1855,8 @@ func checkParserErrors(t *testing.T, p *parser.Parser) {
 	}
 
 	t.Errorf("parser has %d errors", len(errors))
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, d := range errors {
+		t.Errorf("parser error: %q", d.Error())
 	}
 	t.FailNow()
 }
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"github.com/yasaichi-sandbox/monkey/ast"
+	"github.com/yasaichi-sandbox/monkey/token"
+)
+
+// NOTE: `match`の腕のパターンを解析する。識別子、`[`、`{`で始まらなければ、値と比べる式として解析する。
+// 解析に失敗した場合はnilを返す
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseIdentifierPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	value := p.parseExpression(LOWEST)
+	if value == nil {
+		return nil
+	}
+
+	return &ast.ValuePattern{Value: value}
+}
+
+// [ngzk, kykzk, ...rest]
+// └ p.curToken
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{
+		Token:    p.curToken,
+		Elements: []ast.Pattern{},
+	}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken() // NOTE: この時点で`p.curToken`は第n要素のパターン
+
+		// NOTE: `...rest`は最後の要素にしか書けないので、後ろに続くのは`]`だけ
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		el := p.parsePattern()
+		if el == nil || p.panicking {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	pattern.EndToken = p.curToken
+	return pattern
+}
+
+// { "keyakizaka": kykzk }
+// └ p.curToken
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{
+		Token: p.curToken,
+		Pairs: []ast.HashPatternPair{},
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken() // NOTE: この時点で`p.curToken`は第n要素のキー
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken() // NOTE: この時点で`p.curToken`は第n要素のパターン
+		value := p.parsePattern()
+		if value == nil || p.panicking {
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, ast.HashPatternPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	pattern.EndToken = p.curToken
+	return pattern
+}
+
+// kykzk: INTEGER
+// └ p.curToken
+func (p *Parser) parseIdentifierPattern() ast.Pattern {
+	pattern := &ast.IdentifierPattern{
+		Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		pattern.Type = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	return pattern
+}
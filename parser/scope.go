@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/ast"
+)
+
+// NOTE: 静的に検査するための、束縛された名前の集まり。評価器が新しい環境を作るのと同じく、
+// 関数リテラル、`for`と`while`の本体、`match`の腕で新しいスコープを作る（`if`の本体は外側と同じスコープ）。
+// 解析した順に名前を登録するので、後から束縛される名前に関わる誤りは実行時にしか見つからない
+type scope struct {
+	names map[string]bool // NOTE: 値は`const`で束縛したかどうか
+	outer *scope
+}
+
+// NOTE: 内側のスコープの`let`や`const`が外側の束縛を隠す場合に警告する
+func (p *Parser) WarnShadowing() {
+	p.warnShadowing = true
+}
+
+// NOTE: 束縛に関するエラーは構文としては正しいので、エラー回復はせずにそのまま解析を続ける
+func (p *Parser) addBindingError(d Diagnostic) {
+	if p.panicking {
+		return
+	}
+
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+// NOTE: 代入先の名前が、最も内側の束縛で`const`になっていればエラーにする
+func (p *Parser) checkAssignable(ident *ast.Identifier) {
+	for s := p.scope; s != nil; s = s.outer {
+		constant, ok := s.names[ident.Value]
+		if !ok {
+			continue
+		}
+
+		if constant {
+			p.addBindingError(Diagnostic{
+				Severity: SeverityError,
+				Code:     INVALID_ASSIGNMENT,
+				Pos:      ident.Pos(),
+				End:      ident.End(),
+				Message:  fmt.Sprintf("cannot assign to constant %s", ident.Value),
+				Found:    ident.Value,
+			})
+		}
+
+		return
+	}
+}
+
+func (p *Parser) declare(ident *ast.Identifier, constant bool) {
+	p.scope.names[ident.Value] = constant
+}
+
+// NOTE: `let`と`const`による束縛を登録する。関数の引数や`for`の変数は`declare`で直接登録する
+func (p *Parser) declareBinding(stmt *ast.LetStatement) {
+	name := stmt.Name.Value
+
+	if p.scope.names[name] {
+		p.addBindingError(Diagnostic{
+			Severity: SeverityError,
+			Code:     REDECLARED_CONSTANT,
+			Pos:      stmt.Name.Pos(),
+			End:      stmt.Name.End(),
+			Message:  fmt.Sprintf("cannot redeclare constant %s", name),
+			Found:    name,
+		})
+
+		return
+	}
+
+	if _, ok := p.scope.names[name]; !ok && p.warnShadowing {
+		for s := p.scope.outer; s != nil; s = s.outer {
+			if _, ok := s.names[name]; ok {
+				p.addDiagnostic(Diagnostic{
+					Severity: SeverityWarning,
+					Code:     SHADOWED_BINDING,
+					Pos:      stmt.Name.Pos(),
+					End:      stmt.Name.End(),
+					Message:  fmt.Sprintf("%s shadows a binding in an outer scope", name),
+					Found:    name,
+				})
+
+				break
+			}
+		}
+	}
+
+	p.declare(stmt.Name, stmt.IsConst())
+}
+
+// NOTE: パターンが束縛する名前を登録する。`_`は何も束縛しない
+func (p *Parser) declarePattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			p.declarePattern(el)
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			p.declare(pattern.Rest, false)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			p.declarePattern(pair.Value)
+		}
+	case *ast.IdentifierPattern:
+		if pattern.Name.Value != "_" {
+			p.declare(pattern.Name, false)
+		}
+	}
+}
+
+func (p *Parser) enterScope() {
+	p.scope = &scope{names: map[string]bool{}, outer: p.scope}
+}
+
+func (p *Parser) leaveScope() {
+	p.scope = p.scope.outer
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/yasaichi-sandbox/monkey/object"
 	"github.com/yasaichi-sandbox/monkey/parser"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
@@ -15,9 +16,10 @@ const PROMPT = ">> "
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	interpreter := evaluator.NewInterpreter(evaluator.Options{Stdout: out, Stderr: out})
 
 	for {
-		fmt.Printf(PROMPT)
+		io.WriteString(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
@@ -29,11 +31,11 @@ func Start(in io.Reader, out io.Writer) {
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, line, p.Errors())
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		evaluated := interpreter.Eval(program, env)
 		if evaluated == nil {
 			continue
 		}
@@ -55,12 +57,31 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func printParserErrors(out io.Writer, errors []string) {
-	fmt.Fprintln(out, MONKEY_FACE)
+func printParserErrors(out io.Writer, line string, errors []parser.Diagnostic) {
+	// NOTE: 元の`fmt.Fprintln`と同じく顔の後ろに空行を入れる（`go vet`は末尾が改行の`Fprintln`を警告する）
+	io.WriteString(out, MONKEY_FACE+"\n")
 	fmt.Fprintln(out, "Woops! We ran into some monkey business here!")
 	fmt.Fprintln(out, "parser errors:")
 
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+	for _, d := range errors {
+		io.WriteString(out, "\t"+d.Error()+"\n")
+		io.WriteString(out, "\t\t"+line+"\n")
+		io.WriteString(out, "\t\t"+caret(d)+"\n")
 	}
 }
+
+// NOTE: エラー箇所を`^^^`で示す。REPLでは1行ずつ解析するので同じ行に収まっている前提
+func caret(d parser.Diagnostic) string {
+	width := d.End.Column - d.Pos.Column
+	if width < 1 {
+		width = 1
+	}
+
+	// NOTE: 位置が不明な診断（Columnが0）でも`strings.Repeat`が負の数でpanicしないようにする
+	indent := d.Pos.Column - 1
+	if indent < 0 {
+		indent = 0
+	}
+
+	return strings.Repeat(" ", indent) + strings.Repeat("^", width)
+}
@@ -0,0 +1,15 @@
+package vm
+
+import "github.com/yasaichi-sandbox/monkey/object"
+
+// NOTE: クロージャに取り込まれた変数。評価器のクロージャは環境そのものを参照するので、取り込んだ後に
+// 外側の関数が値を入れたり書き換えたりしても見えるように、変数をセルに移して外側の関数と共有する。
+// `const`で束縛したローカル変数も、定数であることを覚えておくためにセルに入れる。
+// スタックやクロージャの中にしか置かれないので、Monkeyのプログラムからは見えない
+type cell struct {
+	value    object.Object // 値がまだ入っていなければnil
+	constant bool          // `const`で束縛されたかどうか
+}
+
+func (c *cell) Inspect() string       { return "cell" }
+func (*cell) Type() object.ObjectType { return "CELL" }
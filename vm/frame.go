@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"github.com/yasaichi-sandbox/monkey/code"
+	"github.com/yasaichi-sandbox/monkey/object"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int   // 呼び出し時点のスタックポインタ。ローカル変数はここから積まれる
+	loops       []int // 実行中のループに入った時点のスタックポインタ（内側のループほど後ろ）
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,35 @@
+package vm
+
+import "github.com/yasaichi-sandbox/monkey/object"
+
+// NOTE: `for`で繰り返す値。評価器と同じく、ループに入る時点で取り出す値をすべて決めておく。
+// スタックの中にしか置かれないので、Monkeyのプログラムからは見えない
+type iterator struct {
+	items []object.Object
+	index int // 次に取り出す値の位置
+}
+
+func (i *iterator) Inspect() string       { return "iterator" }
+func (*iterator) Type() object.ObjectType { return "ITERATOR" }
+
+// NOTE: 配列は要素、ハッシュはキー、文字列は文字（rune）を順に取り出す
+func newIterator(obj object.Object) (*iterator, *object.Error) {
+	var items []object.Object
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		items = obj.Elements
+	case *object.Hash:
+		for _, pair := range obj.Pairs() {
+			items = append(items, pair.Key)
+		}
+	case *object.String:
+		for _, r := range obj.Value {
+			items = append(items, &object.String{Value: string(r)})
+		}
+	default:
+		return nil, newError("cannot iterate over %s", obj.Type())
+	}
+
+	return &iterator{items: items}, nil
+}
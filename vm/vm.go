@@ -0,0 +1,718 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/code"
+	"github.com/yasaichi-sandbox/monkey/compiler"
+	"github.com/yasaichi-sandbox/monkey/evaluator"
+	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/token"
+	"os"
+)
+
+// NOTE: スタックとフレームは足りなくなった分だけ伸ばす。`MaxFrames`は無限再帰でメモリを使い切らないための上限
+const (
+	StackSize   = 2048 // スタックの初期サイズ
+	GlobalsSize = 65536
+	MaxFrames   = 1 << 18
+)
+
+// NOTE: 真偽値とnullは評価器と同じインスタンスを使わないと、`==`や`!`の結果が変わってしまう
+var (
+	True  = evaluator.TRUE
+	False = evaluator.FALSE
+	Null  = evaluator.NULL
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpMod:         "%",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // 常に次に積む位置を指す。スタックの一番上は`stack[sp-1]`
+
+	globals      []object.Object
+	globalConsts []bool // `const`で束縛したグローバル変数
+	globalNames  []string
+
+	builtins []object.BuiltinDefinition
+
+	frames      []*Frame
+	framesIndex int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithBuiltins(bytecode, object.NewBuiltins(os.Stdout))
+}
+
+// NOTE: `builtins`にはコンパイラに渡したものと同じ組み込み関数の一覧を渡す。
+// VMごとに一覧を持つので、`puts`の出力先もVMごとに変えられる
+func NewWithBuiltins(bytecode *compiler.Bytecode, builtins []object.BuiltinDefinition) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    len(bytecode.LocalNames),
+		Positions:    bytecode.Positions,
+		LocalNames:   bytecode.LocalNames,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	frames := []*Frame{NewFrame(mainClosure, 0)}
+
+	vm := &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals:      make([]object.Object, GlobalsSize),
+		globalConsts: make([]bool, GlobalsSize),
+		globalNames:  bytecode.GlobalNames,
+
+		builtins: builtins,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+
+	// NOTE: メインのフレームのローカル変数の分だけ、スタックを空けておく
+	vm.growStack(mainFn.NumLocals)
+	vm.sp = mainFn.NumLocals
+
+	return vm
+}
+
+// NOTE: 評価器の`Eval`の戻り値に相当する、最後に評価された式の値
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// NOTE: Monkeyの実行時エラーは、評価器と同じく位置とスタックトレース付きの`*object.Error`で返す
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip := vm.currentFrame().ip
+		ins := vm.currentFrame().Instructions()
+		op := code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		case code.OpDup:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			for _, o := range vm.stack[vm.sp-n : vm.sp] {
+				if err := vm.push(o); err != nil {
+					return err
+				}
+			}
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			right := vm.pop()
+			left := vm.pop()
+
+			result := evaluator.EvalInfixExpression(infixOperators[op], left, right)
+			if err := vm.pushResult(result); err != nil {
+				return err
+			}
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpMinus:
+			result := evaluator.EvalPrefixExpression("-", vm.pop())
+			if err := vm.pushResult(result); err != nil {
+				return err
+			}
+		case code.OpBang:
+			result := evaluator.EvalPrefixExpression("!", vm.pop())
+			if err := vm.pushResult(result); err != nil {
+				return err
+			}
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1 // NOTE: ループの先頭でインクリメントされるので1つ手前にしておく
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpError:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			return vm.error(newError("%s", vm.constants[constIndex].(*object.String).Value))
+		case code.OpEnterLoop:
+			frame := vm.currentFrame()
+			frame.loops = append(frame.loops, vm.sp)
+		case code.OpExitLoop:
+			frame := vm.currentFrame()
+			frame.loops = frame.loops[:len(frame.loops)-1]
+		case code.OpBreak, code.OpContinue:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+
+			// NOTE: 式の途中で抜けた場合に積まれたままの値を捨てる
+			frame := vm.currentFrame()
+			vm.sp = frame.loops[len(frame.loops)-1]
+			frame.ip = pos - 1
+		case code.OpIter:
+			it, err := newIterator(vm.pop())
+			if err != nil {
+				return vm.error(err)
+			}
+
+			if err := vm.push(it); err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it := vm.stack[vm.sp-1].(*iterator)
+			if it.index == len(it.items) {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+
+			it.index++
+			if err := vm.push(it.items[it.index-1]); err != nil {
+				return err
+			}
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				return vm.error(newError("identifier not found: %s", vm.globalNames[globalIndex]))
+			}
+
+			if err := vm.push(value); err != nil {
+				return err
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := value.(*cell); ok {
+				value = c.value
+			}
+			if value == nil {
+				return vm.error(newError("identifier not found: %s", frame.cl.Fn.LocalNames[localIndex]))
+			}
+
+			if err := vm.push(value); err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.builtins[builtinIndex].Builtin); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cl := vm.currentFrame().cl
+			value := cl.Free[freeIndex].(*cell).value
+			if value == nil {
+				return vm.error(newError("identifier not found: %s", cl.Fn.FreeNames[freeIndex]))
+			}
+
+			if err := vm.push(value); err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.currentFrame().cl.Free[freeIndex].(*cell).value = vm.pop()
+		case code.OpSetGlobalConst:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+			vm.globalConsts[globalIndex] = true
+		case code.OpSetLocalConst:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// NOTE: 既にクロージャに取り込まれていれば、同じセルを定数にする
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+				c.constant = true
+			} else {
+				*slot = &cell{value: vm.pop(), constant: true}
+			}
+		case code.OpIsConstGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(nativeBoolToBooleanObject(vm.globalConsts[globalIndex])); err != nil {
+				return err
+			}
+		case code.OpIsConstLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			c, ok := vm.stack[vm.currentFrame().basePointer+int(localIndex)].(*cell)
+			if err := vm.push(nativeBoolToBooleanObject(ok && c.constant)); err != nil {
+				return err
+			}
+		case code.OpIsConstFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			c := vm.currentFrame().cl.Free[freeIndex].(*cell)
+			if err := vm.push(nativeBoolToBooleanObject(c.constant)); err != nil {
+				return err
+			}
+		case code.OpDefinedGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(nativeBoolToBooleanObject(vm.globals[globalIndex] != nil)); err != nil {
+				return err
+			}
+		case code.OpDefinedLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			value := vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if c, ok := value.(*cell); ok {
+				value = c.value
+			}
+
+			if err := vm.push(nativeBoolToBooleanObject(value != nil)); err != nil {
+				return err
+			}
+		case code.OpDefinedFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			value := vm.currentFrame().cl.Free[freeIndex].(*cell).value
+			if err := vm.push(nativeBoolToBooleanObject(value != nil)); err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// NOTE: 初めて取り込まれる変数はセルに移し、以後は外側の関数もセルを通して読み書きする
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			c, ok := (*slot).(*cell)
+			if !ok {
+				c = &cell{value: *slot}
+				*slot = c
+			}
+
+			if err := vm.push(c); err != nil {
+				return err
+			}
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return err
+			}
+		case code.OpClearLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = nil
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			result := evaluator.EvalIndexExpression(left, index)
+			if err := vm.pushResult(result); err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			result := evaluator.EvalIndexAssignment(left, index, value)
+			if err := vm.pushResult(result); err != nil {
+				return err
+			}
+		case code.OpMatchValue:
+			expected := vm.pop()
+			value := vm.pop()
+
+			if err := vm.push(nativeBoolToBooleanObject(object.Equal(value, expected))); err != nil {
+				return err
+			}
+		case code.OpNoMatch:
+			subject := vm.pop()
+
+			return vm.error(newError("no match arm for %s: %s", subject.Type(), subject.Inspect()))
+		case code.OpMatchType:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			matched, err := evaluator.MatchType(vm.pop(), vm.constants[constIndex].(*object.String).Value)
+			if err != nil {
+				return vm.error(err)
+			}
+
+			if err := vm.push(nativeBoolToBooleanObject(matched)); err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			n := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			array, ok := vm.pop().(*object.Array)
+			matched := ok && len(array.Elements) >= n && (rest || len(array.Elements) == n)
+
+			if err := vm.push(nativeBoolToBooleanObject(matched)); err != nil {
+				return err
+			}
+		case code.OpMatchKey:
+			key := vm.pop()
+			hash := vm.pop().(*object.Hash)
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return vm.error(newError("unusable as hash key: %s", key.Type()))
+			}
+
+			_, ok = hash.Get(hashKey)
+			if err := vm.push(nativeBoolToBooleanObject(ok)); err != nil {
+				return err
+			}
+		case code.OpRest:
+			n := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.pop().(*object.Array)
+			rest := make([]object.Object, len(array.Elements)-n)
+			copy(rest, array.Elements[n:])
+
+			if err := vm.push(&object.Array{Elements: rest}); err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// NOTE: トップレベルの`return`はプログラムの実行を終える
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1 // NOTE: 呼び出された関数自体もスタックから取り除く
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown opcode: %d", op)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := &object.Hash{}
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return nil, vm.error(newError("unusable as hash key: %s", key.Type()))
+		}
+
+		hash.Set(hashable, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	// NOTE: 組み込み関数（埋め込む側が定義したものも含む）が引数を持ち続けても、後の命令で書き換わらないように写す
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	// NOTE: 組み込み関数は返す値がない場合にnilを返す
+	if result == nil {
+		return vm.push(Null)
+	}
+
+	return vm.pushResult(result)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		// NOTE: 評価器では引数を束縛する時点で呼び出し先の関数に入っているので、それに合わせる
+		err := newError(
+			"wrong number of arguments. got=%d, want=%d",
+			numArgs,
+			cl.Fn.NumParameters,
+		)
+		err.Stack = []object.StackFrame{{Function: cl.Fn.Name, CallSite: vm.currentPosition()}}
+
+		return vm.error(err)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return vm.error(newError("stack overflow"))
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	vm.growStack(frame.basePointer + cl.Fn.NumLocals)
+
+	// NOTE: 前の呼び出しで使った値が残っていると、まだ束縛していない変数に値があるように見えてしまう
+	for i := vm.sp; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) currentPosition() token.Position {
+	return positionAt(vm.currentFrame())
+}
+
+// NOTE: 評価器と同じく、エラーが起きた位置と、そこに至るまでの関数呼び出しを記録する
+func (vm *VM) error(err *object.Error) error {
+	if !err.Pos.IsValid() {
+		err.Pos = vm.currentPosition()
+	}
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		err.Stack = append(err.Stack, object.StackFrame{
+			Function: vm.frames[i].cl.Fn.Name,
+			CallSite: positionAt(vm.frames[i-1]),
+		})
+	}
+
+	return err
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	}
+
+	return vm.error(newError("not a function: %s", callee.Type()))
+}
+
+// NOTE: スタックに少なくとも`size`個の要素を置けるようにする
+func (vm *VM) growStack(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+
+	newSize := 2 * len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+
+	return o
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) error {
+	vm.growStack(vm.sp + 1)
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+// NOTE: 演算の結果がエラーであれば、スタックに積まずに実行を止める
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		return vm.error(err)
+	}
+
+	return vm.push(result)
+}
+
+func isTruthy(obj object.Object) bool {
+	return obj != False && obj != Null
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+
+	return False
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// NOTE: `ip`はオペランドを指していることもあるので、それ以前で最も近い命令の位置を探す
+func positionAt(f *Frame) token.Position {
+	var pos token.Position
+	found := -1
+
+	for offset, p := range f.cl.Fn.Positions {
+		if offset <= f.ip && offset > found {
+			pos = p
+			found = offset
+		}
+	}
+
+	return pos
+}
@@ -0,0 +1,509 @@
+package vm_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/yasaichi-sandbox/monkey/compiler"
+	"github.com/yasaichi-sandbox/monkey/evaluator"
+	"github.com/yasaichi-sandbox/monkey/lexer"
+	"github.com/yasaichi-sandbox/monkey/object"
+	"github.com/yasaichi-sandbox/monkey/parser"
+	"github.com/yasaichi-sandbox/monkey/vm"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// NOTE: VMは評価器と同じ結果とエラーを返すべきなので、両方で実行して`Inspect()`の結果を比べる
+func TestCompatibilityWithEvaluator(t *testing.T) {
+	inputs := []string{
+		// 整数・小数・多倍長整数
+		"5 + 5 + 5 + 5 - 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"-7 % 3",
+		"let min = -9223372036854775807 - 1; min % -1",
+		"9223372036854775807 + 1",
+		"let min = -9223372036854775807 - 1; min / -1",
+		"99999999999999999999 / 3",
+		"99999999999999999999 + 0.5",
+		"1 + 0.5",
+		"7.5 % 2",
+		"1 / 0.0 > 1e308",
+		"0.1 + 0.2 == 0.3",
+		// 真偽値
+		"1 < 2",
+		"2 > 2.5",
+		"true != false",
+		"(1 < 2) == true",
+		"!5",
+		"!!false",
+		// 文字列
+		`"Hello" + " " + "World!"`,
+		`"日本語"[1]`,
+		`let s = "🐵🙈"; s[len(s) - 1]`,
+		`"monkey"[6]`,
+		// 条件分岐
+		"if (1) { 10 }",
+		"if (1 > 2) { 10 }",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (false) { 10 } else { if (true) { 30 } }",
+		"if (false) { 10 } else if (1 > 2) { 20 } else { 30 }",
+		// 変数束縛
+		"let a = 5; let b = a; let c = a + b + 5; c;",
+		"let a = 1; let a = a + 1; a",
+		"let a = a + 1;",
+		"if (false) { foobar } else { 1 }",
+		"if (false) { let x = 1; }; x",
+		"if (true) { let x = 1; }; x",
+		// NOTE: 名前は実行時に解決するので、後で束縛する名前も参照できる
+		"let f = fn() { g() }; let g = fn() { 1 }; f()",
+		"let f = fn() { g() }; f(); let g = fn() { 1 };",
+		"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(10)",
+		"fn() { let f = fn() { g() }; let g = fn() { 2 }; f() }()",
+		"fn() { let f = fn() { g() }; f() }()",
+		// NOTE: 内側で束縛する前は外側の同じ名前を参照する
+		"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()",
+		"let x = 1; let f = fn(c) { if (c) { let x = 2; }; x }; f(false) + f(true)",
+		"let x = 1; let f = fn() { fn() { x } }; let g = f(); let x = 3; g()",
+		"let f = fn(x) { let x = x * 2; x }; f(4)",
+		"let len = fn(x) { 0 }; len([1])",
+		"let f = fn() { len([1]) }; let r = f(); let len = fn(x) { 0 }; r + f()",
+		// return
+		"return 10; 9;",
+		"9; return 2 * 5; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+		"let f = fn(x) { let result = x + 10; return result; return 10; }; f(10);",
+		// 関数
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"fn(x) { x; }(5)",
+		"let newAdder = fn(x) { fn(y) { x + y }; }; let addTwo = newAdder(2); addTwo(2);",
+		"let f = fn(a) { let b = a * 2; fn(c) { fn(d) { a + b + c + d } } }; f(1)(2)(3)",
+		"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(3) }; f()",
+		// NOTE: 評価器の`TestClosures`
+		"let newAdder = fn(x) {\n  fn(y) { x + y };\n};\n\nlet addTwo = newAdder(2);\naddTwo(2);",
+		// 深い再帰
+		"let c = fn(n) { if (n == 0) { 0 } else { 1 + c(n - 1) } }; c(2000)",
+		"let c = fn(n) { if (n == 0) { 0 } else { 1 + c(n - 1) } }; c(100000)",
+		// 配列とハッシュ
+		"[1, 2 * 2, 3 + 3]",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+		"[1, 2, 3][-1]",
+		`let two = "two"; {"one": 10 - 9, two: 1 + 1}["two"]`,
+		`{"foo": 5}["bar"]`,
+		`{"b": 1, "a": 2, 1: [3], "b": 4}`,
+		`{1: 5}[1.0]`,
+		`{99999999999999999999: 5}[99999999999999999998 + 1]`,
+		// NOTE: 評価器の`TestBuiltinFunctions`
+		`len("")`,
+		`len("four")`,
+		`len("hello world")`,
+		`len("こんにちは")`,
+		`len(1)`,
+		`len("one", "two")`,
+		`len([1, 2, 3])`,
+		`len([])`,
+		`first([1, 2, 3])`,
+		`first([])`,
+		`first(1)`,
+		`last([1, 2, 3])`,
+		`last([])`,
+		`last(1)`,
+		`rest([1, 2, 3])`,
+		`rest([])`,
+		`push([], 1)`,
+		`push(1, 1)`,
+		`puts("hello", "world!")`,
+		`int(3.9)`,
+		`int(-3.9)`,
+		`int("42")`,
+		`int("4.2")`,
+		`int(true)`,
+		`float(3)`,
+		`float("2.5")`,
+		`float("abc")`,
+		`let map = fn(arr, f) { if (len(arr) == 0) { [] } else { push(map(rest(arr), f), f(first(arr))) } }; map([1, 2, 3], fn(x) { x * 2 })`,
+		// NOTE: 評価器の`TestErrorHandling`
+		"5 + true;",
+		"5 + true; 5;",
+		"-true",
+		"true + false;",
+		"5; true + false; 5",
+		"if (10 > 1) { true + false; }",
+		"\nif (10 > 1) {\n  if (10 > 1) {\n    return true + false;\n  }\n\n  return 1;\n}\n",
+		"foobar",
+		"1 / 0",
+		"5 % 0",
+		"99999999999999999999 / 0",
+		"99999999999999999999 % 0",
+		"1 + (true + false);",
+		"fn() { 1 + true }();",
+		`"Hello" - "World"`,
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		"fn(x) { x }(1, 2);",
+		"1(2);",
+		// NOTE: 評価器の`TestAssignExpressions`
+		"let x = 1; x = 2; x",
+		"let x = 1; x = x + 1",
+		"let a = 1; let b = 2; a = b = 3; a + b",
+		"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x",
+		`let s = "mon"; s += "key"; s`,
+		"let x = 9223372036854775807; x += 1; x",
+		"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",
+		"let n = 0; let inc = fn() { n = n + 1; }; inc(); inc(); n",
+		"let n = 0; let f = fn(n) { n = 5 }; f(1); n",
+		"let total = 0; for (x in [1, 2, 3]) { total += x } total",
+		"let i = 0; while (i < 3) { i += 1 } i",
+		"let arr = [1, 2, 3]; arr[1] = 20; arr",
+		"let arr = [1, 2, 3]; arr[2] *= 10; arr[2]",
+		"let a = [1]; let b = a; b[0] = 2; a",
+		`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h`,
+		`let h = {}; h[[1][0]] = "one"; h`,
+		"let a = [1, 2]; a[0] = a; a",
+		`let h = {}; h["self"] = h; [h]`,
+		"let a = [1, 2]; a[0] = a; json_encode(a)",
+		"x = 1",
+		"x = puts(1)",
+		"let f = fn() { y = 1 }; f()",
+		"len = 1",
+		"let x = 1; x += true",
+		"let arr = [1]; arr[1] = 2",
+		"let arr = [1]; arr[-1] = 2",
+		`let arr = [1]; arr["0"] = 2`,
+		`let h = {}; h[fn() {}] = 1`,
+		`let s = "abc"; s[0] = "x"`,
+		`let h = {}; h["a"] += 1`,
+		// NOTE: 値が入っている最も内側の変数に代入する
+		"let x = 1; let f = fn() { x = 2; let x = 3; x = 4; x }; [f(), x]",
+		"let x = 1; for (i in [1, 2]) { x += i; let x = 10; x += i; puts(x) } x",
+		"let f = fn() { let n = 0; let g = fn() { n += 1; n }; g(); g() + n }; f()",
+		"let f = fn() { let n = 0; let inc = fn() { n += 1 }; let get = fn() { n }; inc(); inc(); get() }; f()",
+		"let xs = [[1], [2]]; xs[1][0] += 5; xs",
+		"let i = 0; let h = {}; h[i += 1] = i; h",
+		// NOTE: 評価器の`TestConstStatements`
+		"const a = 5; a * 2",
+		"const a = 5; let f = fn() { let a = 1; a += 1; a }; f() + a",
+		"let a = 1; const a = 2; a",
+		"const a = 1; let f = fn() { a = 2 }; f()",
+		"let f = fn() { a += 1 }; const a = 1; f()",
+		"const a = 1; let a = 2;",
+		"const a = 1; const a = 2;",
+		"let i = 0; while (i < 2) { const x = i; i += 1 } i",
+		"for (i in [1, 2]) { const x = i; } 1",
+		// NOTE: 定数かどうかは、値が入っている最も内側の束縛で決まる
+		`const a = 1; a = puts("not evaluated")`,
+		`const a = 1; let a = puts("not evaluated")`,
+		"let f = fn() { const n = 1; let g = fn() { n += 1 }; g() }; f()",
+		"let f = fn() { let g = fn() { n }; const n = 2; g() }; f()",
+		"const x = 1; let f = fn() { x = 2; let x = 3; }; f()",
+		"const x = 1; let f = fn() { let x = 3; x = 4; x }; f()",
+		"let f = fn() { const x = 1; let x = 2; }; f()",
+		"for (i in [1, 2]) { const x = i; x = 3 }",
+		"let xs = []; for (i in [1, 2]) { const x = i; let xs = push(xs, fn() { x }) } 1",
+		// NOTE: 評価器の`TestLoops`
+		"let i = 0; while (i < 5) { i += 1 } i",
+		"while (false) { 1 }",
+		"let i = 0; while (true) { if (i == 3) { break; } i += 1 } i",
+		"let i = 0; let s = 0; while (i < 5) { i += 1; if (i == 2) { continue; } s += i } s",
+		"for (x in [1, 2, 3]) { puts(x) }",
+		`for (k in {"b": 1, "a": 2}) { puts(k) }`,
+		`for (c in "日本") { puts(c) }`,
+		"for (x in [1, 2, 3, 4]) { if (x == 2) { continue } if (x == 4) { break } puts(x) }",
+		"for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y > x) { break } puts(x * 10 + y) } }",
+		"let find = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; find([1, 5, 7])",
+		"let find = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; find([])",
+		"let x = 10; for (x in [1]) { puts(x) } x",
+		"let f = fn(n) { while (true) { if (n > 2) { break } n += 1 } n }; f(0)",
+		"for (x in 5) { x }",
+		"while (true) { 1 + true }",
+		"for (x in [1]) { y }",
+		"let r = 0; while (true) { let x = if (true) { break; }; r = 1 } r",
+		"let a = [1]; for (x in [1, 2]) { a = push(a, if (x == 1) { continue; } else { x }) } a",
+		"let i = 0; while (i < 2) { let y = i; i += 1 } y",
+		"let fs = []; let i = 0; while (i < 2) { let j = i; fs = push(fs, fn() { j }); i += 1 } [fs[0](), fs[1]()]",
+		"let f = fn() { for (x in [1]) { let y = [if (true) { return x * 2 }] } 0 }; f()",
+		// NOTE: ループの本体は繰り返しごとに新しいスコープになる
+		"let fs = []; for (x in [1, 2]) { let fs = push(fs, fn() { x }) } fs",
+		"let f = fn() { let fs = []; for (x in [1, 2, 3]) { let y = x * 2; let fs = push(fs, fn() { x + y }) } fs }; let fs = f(); [fs[0](), fs[1](), fs[2]()]",
+		"let g = []; for (x in [1, 2, 3]) { let g = [fn() { x }]; if (x == 2) { break } } g",
+		"let y = 1; for (x in [1, 2]) { puts(y); let y = x * 10; puts(y) } y",
+		"for (x in [1, 2]) { if (x == 2) { puts(z) } let z = x }",
+		"let f = fn() { for (x in [1]) { return fn() { x } } }; f()()",
+		"let s = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { continue } let s = s + x * y } } s",
+		"while (true) { break } 1",
+		"fn() { while (false) { } }()",
+		"if (true) { for (x in []) { } }",
+		// NOTE: 評価器の`TestMatchExpressions`
+		`match (2) { 1 => "one", 2 => "two", _ => "many" }`,
+		`match (5) { 1 => "one", 2 => "two", _ => "many" }`,
+		`match ("a") { "b" => 1, "a" => 2 }`,
+		"match (true) { false => 0, true => 1 }",
+		`match (1.0) { 1 => "int", }`,
+		`let x = 3; match (x * 2) { (x + x) => "double" }`,
+		"match (first([])) { 0 => 1, _ => 2 }",
+		"match (1) { 1 => 1, 2 => 1 + true }",
+		`let f = fn(n) { match (n) { 0 => "zero", _ => f(n - 1) } }; f(3)`,
+		`match (3) { 1 => "one", 2 => "two" }`,
+		`match ("c") {}`,
+		"match (1) { (y) => 1 }",
+		"match (5) { n => n * 2 }",
+		"let n = 1; match (5) { n => n }; n",
+		// NOTE: 腕は試すたびに新しいスコープになる
+		"let i = 0; let s = 0; while (i < 3) { s += match (i) { 0 => 10, n => n }; i += 1 } s",
+		"let n = 1; let f = fn(x) { match (x) { 0 => n, n => n } }; [f(5), f(0)]",
+		"let fs = []; for (x in [1, 2]) { fs = push(fs, match (x) { n => fn() { n } }) } [fs[0](), fs[1]()]",
+		"match (1) { 1 => if (true) { let y = 2; y } } ",
+		"match (match (1) { 1 => 2 }) { 2 => match (3) { n => n } }",
+		"match ([1, 2, 3]) { [first, ...rest] => rest }",
+		`match ([1, 2, 3]) { [a, b] => "two", [a, b, c] => a + b + c }`,
+		`match ([1]) { [a, b, ...rest] => "many", [a, ...rest] => rest }`,
+		`match ([]) { [x, ..._] => x, [] => "empty" }`,
+		"match ([1, [2, 3]]) { [1, [_, y]] => y }",
+		`match ([2, 2]) { [x, (x)] => "pair", _ => "other" }`,
+		`match ({"name": "Monkey", "age": 5}) { {"name": n} => n }`,
+		`match ({"age": 5}) { {"name": n} => n, {"age": a} => a }`,
+		`match ({"user": {"tags": ["a", "b"]}}) { {"user": {"tags": [t, ..._]}} => t }`,
+		`let k = "id"; match ({"id": 7}) { {k: 7} => "found" }`,
+		`match (1.5) { x: INTEGER => "int", x: FLOAT => "float" }`,
+		`match (99999999999999999999) { x: INTEGER => "int" }`,
+		`match (len) { f: FUNCTION => "fn" }`,
+		`match (first([])) { _: NULL => "null" }`,
+		`match ([1, "a"]) { [x: INTEGER, y: INTEGER] => 1, [x: INTEGER, y: STRING] => y }`,
+		`match (-3) { n if n > 0 => "positive", n if n < 0 => "negative", _ => "zero" }`,
+		`match ([5, 1]) { [a, b] if a < b => "asc", [a, b] => "desc" }`,
+		"let f = fn(xs) { match (xs) { [] => 0, [x, ...rest] => x + f(rest) } }; f([1, 2, 3, 4])",
+		"match (1) { x: INT => x }",
+		"match (1) { 1 => 1, x: INT => x }",
+		"match ({}) { {[]: x} => x }",
+		"match (1) { n if n + true => n }",
+		"match ([1, 2]) { [x] => x }",
+		`match ({"a": null}) { {"a": x} => [x], _ => 0 }`,
+		"let xs = [1, 2, 3]; let r = match (xs) { [_, ...rest] => rest }; r = push(r, 4); xs",
+		`let k = fn() { puts("key"); "a" }; match ({"a": 1}) { {k(): x} => x }`,
+		"match (3) { n => { let m = n * 2; m + 1 } }",
+		"let m = 1; match (2) { n => { let m = n; m } }; m",
+		`let h = match (1) { _ => ({"a": 1}) }; h["a"]`,
+		`let f = fn(n) { match (n) { 0 => { return "zero"; 1 }, _ => { let r = f(n - 1); r } } }; f(3)`,
+		"let i = 0; while (i < 3) { match (i) { 1 => { i += 2; continue; }, _ => { i += 1 } } } i",
+		"match (1) { _ => {} }",
+		`let f = fn(n) { match (n) { 0 => {}, _ => { let y = n; } } }; [f(0), f(1)]`,
+		`let f = fn() { match (1) { (if (true) { return 5 }) => 0, _ => 1 } }; f()`,
+		`match (9007199254740993) { 9007199254740992.0 => "same", _ => "different" }`,
+		"[9007199254740993 == 9007199254740992.0, 9007199254740993 > 9007199254740992.0, {9007199254740992.0: 1}[9007199254740993]]",
+		`while (true) { match ([1]) { [(if (true) { break; })] => 0, _ => 1 } } "done"`,
+		`let f = fn() { match ({"a": 1}) { {(if (true) { return "key" }): x} => x } }; f()`,
+		// その他のエラー
+		"let x = fn() { y }; x()",
+		"let f = fn() { let g = fn() { h() }; g() }; f()",
+		"let add = fn(a, b) {\n  a + b\n};\nlet apply = fn(f) {\n  f(1, \"two\")\n};\napply(add);",
+		"let f = fn(g) {\n  g()\n};\nf(fn(x) { x });",
+		"let f = fn() {\n  len(1)\n};\nf();",
+	}
+
+	for _, input := range inputs {
+		var expectedOutput, actualOutput bytes.Buffer
+		expected := testEval(input, &expectedOutput).Inspect()
+		actual := testRun(t, input, &actualOutput).Inspect()
+
+		if actual != expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", input, expected, actual)
+		}
+
+		if actualOutput.String() != expectedOutput.String() {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot =%q", input, expectedOutput.String(), actualOutput.String())
+		}
+	}
+}
+
+// NOTE: 組み込み関数が受け取った引数を持ち続けても、VMのスタックとは切り離されている
+func TestBuiltinArgumentsAreCopied(t *testing.T) {
+	var kept []object.Object
+	builtins := append(object.NewBuiltins(io.Discard), object.BuiltinDefinition{
+		Name: "keep",
+		Builtin: &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			kept = args
+			return nil
+		}},
+	})
+
+	program := parser.New(lexer.New(`keep(1, 2); let a = [3, 4, 5]; a`)).ParseProgram()
+
+	c := compiler.NewWithBuiltins(builtins)
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.NewWithBuiltins(c.Bytecode(), builtins)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if len(kept) != 2 || kept[0].Inspect() != "1" || kept[1].Inspect() != "2" {
+		t.Errorf("arguments were overwritten. got=%v", kept)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `
+	let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	result, ok := testRun(t, input, io.Discard).(*object.Hash)
+	if !ok {
+		t.Fatalf("VM didn't return Hash. got=%T", result)
+	}
+
+	// NOTE: ペアはリテラルに書かれた順に並ぶ
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{vm.True, 5},
+		{vm.False, 6},
+	}
+
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+	}
+
+	for i, pair := range result.Pairs() {
+		if pair.Key.(object.Hashable).HashKey() != expected[i].key.HashKey() {
+			t.Errorf("pair %d has wrong key. want=%s, got=%s", i, expected[i].key.Inspect(), pair.Key.Inspect())
+		}
+
+		value, ok := result.Get(expected[i].key)
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+
+		integer, ok := value.(*object.Integer)
+		if !ok || integer.Value != expected[i].value {
+			t.Errorf("wrong value. want=%d, got=%+v", expected[i].value, value)
+		}
+	}
+}
+
+// NOTE: オペランドの上限ちょうどまでは評価器と同じ結果になり、それを超えるとコンパイルエラーになる
+func TestOperandLimits(t *testing.T) {
+	lets := func(n int) string {
+		var out strings.Builder
+		out.WriteString("let f = fn() { ")
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&out, "let x%d = %d; ", i, i)
+		}
+		out.WriteString("x0 + x" + strconv.Itoa(n-1) + " }; f()")
+
+		return out.String()
+	}
+
+	ones := func(n int) string {
+		return "len([" + strings.Repeat("1, ", n-1) + "1])"
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{lets(256), "255"},
+		{lets(300), "ERROR: 1:3892: operand of OpSetLocal out of range: 256 (max 255)"},
+		{ones(65535), "65535"},
+		{ones(70000), "ERROR: 1:5: operand of OpArray out of range: 70000 (max 65535)"},
+	}
+
+	for _, tt := range tests {
+		actual := testRun(t, tt.input, io.Discard).Inspect()
+		if actual != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestRecursiveFibonacci(t *testing.T) {
+	input := `
+	let fibonacci = fn(x) {
+	  if (x == 0) {
+	    return 0;
+	  } else {
+	    if (x == 1) {
+	      return 1;
+	    } else {
+	      fibonacci(x - 1) + fibonacci(x - 2);
+	    }
+	  }
+	};
+	fibonacci(15);
+	`
+
+	integer, ok := testRun(t, input, io.Discard).(*object.Integer)
+	if !ok || integer.Value != 610 {
+		t.Errorf("wrong result. want=610, got=%+v", integer)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	input := "let f = fn(x) { f(x + 1) }; f(0);"
+
+	errObj, ok := testRun(t, input, io.Discard).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned.")
+	}
+
+	if errObj.Message != "stack overflow" {
+		t.Errorf("wrong error message. expected=%q, got=%q", "stack overflow", errObj.Message)
+	}
+}
+
+func testEval(input string, out io.Writer) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	// NOTE: VMは関数呼び出しのネストを`MaxFrames`で制限するので、評価器でも深い再帰を試せるように制限しない
+	interpreter := evaluator.NewInterpreter(evaluator.Options{Stdout: out, MaxCallDepth: -1})
+	return interpreter.Eval(program, env)
+}
+
+// NOTE: 評価器と比べやすいように、Monkeyのエラーは戻り値の`object.Error`として返す
+func testRun(t *testing.T, input string, out io.Writer) object.Object {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	builtins := object.NewBuiltins(out)
+	c := compiler.NewWithBuiltins(builtins)
+	if err := c.Compile(program); err != nil {
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		return errObj
+	}
+
+	machine := vm.NewWithBuiltins(c.Bytecode(), builtins)
+	if err := machine.Run(); err != nil {
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		return errObj
+	}
+
+	return machine.LastPoppedStackElem()
+}